@@ -46,6 +46,7 @@ const BookingChatScreen = ({ navigateTo }) => {
     }
   ]);
 
+  const [sessionId, setSessionId] = useState(null);
   const [inputValue, setInputValue] = useState('');
   const [isLoading, setIsLoading] = useState(false);
 
@@ -70,36 +71,41 @@ const BookingChatScreen = ({ navigateTo }) => {
     setMessageIdCounter(messageIdCounter + 1); // Update counter for next messages
     
     try {
-      // Prepare messages for AI (excluding UI-specific properties)
-      const aiMessages = newMessages
-        .filter(msg => msg.sender === 'user' || msg.sender === 'bot')
-        .map(msg => ({
-          role: msg.sender === 'user' ? 'user' : 'assistant',
-          content: msg.text,
-          // Include timestamp for backend processing
-          ...(msg.sender === 'user' && {
-            timestamp: new Date().toLocaleDateString('en-US', { 
-              weekday: 'long', 
-              year: 'numeric', 
-              month: 'long', 
-              day: 'numeric',
-              hour: '2-digit',
-              minute: '2-digit',
-              hour12: true
-            })
-          })
-        }));
-      
       // Use the current domain for API calls
       const apiUrl = `${window.location.origin}`;
-      
-      // Send to backend AI service
+
+      // The server keeps the conversation history, start a session on the first message
+      let activeSessionId = sessionId;
+      if (!activeSessionId) {
+        const sessionResponse = await fetch(`${apiUrl}/api/chat/sessions`, { method: 'POST' });
+        if (!sessionResponse.ok) {
+          throw new Error(`HTTP error! status: ${sessionResponse.status}`);
+        }
+        const session = await sessionResponse.json();
+        activeSessionId = session.session_id;
+        setSessionId(activeSessionId);
+      }
+
+      // Send only the new user turn to the backend AI service
       const response = await fetch(`${apiUrl}/api/chat/message`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ messages: aiMessages }),
+        body: JSON.stringify({
+          session_id: activeSessionId,
+          message: userMessage.text,
+          // Include timestamp for backend processing
+          timestamp: new Date().toLocaleDateString('en-US', { 
+            weekday: 'long', 
+            year: 'numeric', 
+            month: 'long', 
+            day: 'numeric',
+            hour: '2-digit',
+            minute: '2-digit',
+            hour12: true
+          })
+        }),
       });
       
       if (!response.ok) {
@@ -111,68 +117,16 @@ const BookingChatScreen = ({ navigateTo }) => {
       // Generate a new unique ID for the AI message
       const newAiMessageId = messageIdCounter + 1;
       
-      // Handle different response types
-      if (data.type === 'house_options') {
-        // Parse the houses JSON string
-        const houses = JSON.parse(data.houses);
-        
-        // Add AI response with house options to chat
-        const aiMessage = {
-          id: newAiMessageId,
-          sender: 'bot',
-          text: data.message,
-          houses: houses, // Include houses data
-          timestamp: new Date()
-        };
-        
-        setMessages(prevMessages => [...prevMessages, aiMessage]);
-      } else {
-        // Check if the message contains booking summary data
-        const bookingSummary = extractBookingSummary(data.message);
-        
-        if (bookingSummary) {
-          // Add the booking summary as a regular message in the chat, but hide the JSON part
-          const cleanMessage = data.message.replace(/<\[BOOKING_SUMMARY\]>.*?<\/\[BOOKING_SUMMARY\]>/s, '').trim();
-          
-          const aiMessage = {
-            id: newAiMessageId,
-            sender: 'bot',
-            text: cleanMessage,
-            bookingSummary: bookingSummary,
-            avatar: (
-              <svg className="h-8 w-8 text-[#38e07b]" fill="none" height="32" viewBox="0 0 24 24" width="32" xmlns="http://www.w3.org/2000/svg">
-                <path d="M12 2L1 9L4 22H20L23 9L12 2Z" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M12 2V22" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M23 9H1" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M4 22L12 15L20 22" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M10 12H14" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-              </svg>
-            ),
-            timestamp: new Date()
-          };
-          
-          setMessages(prevMessages => [...prevMessages, aiMessage]);
-        } else {
-          // Add regular AI response to chat
-          const aiMessage = {
-            id: newAiMessageId,
-            sender: 'bot',
-            text: data.message,
-            avatar: (
-              <svg className="h-8 w-8 text-[#38e07b]" fill="none" height="32" viewBox="0 0 24 24" width="32" xmlns="http://www.w3.org/2000/svg">
-                <path d="M12 2L1 9L4 22H20L23 9L12 2Z" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M12 2V22" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M23 9H1" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M4 22L12 15L20 22" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-                <path d="M10 12H14" stroke="currentColor" strokeLinecap="round" strokeLinejoin="round" strokeWidth="1.5"></path>
-              </svg>
-            ),
-            timestamp: new Date()
-          };
-          
-          setMessages(prevMessages => [...prevMessages, aiMessage]);
-        }
-      }
+      // The reply is an ordered list of typed parts: text, house_options,
+      // booking_summary and booking_confirmation
+      const aiMessage = {
+        id: newAiMessageId,
+        sender: 'bot',
+        parts: data.parts || [],
+        timestamp: new Date()
+      };
+
+      setMessages(prevMessages => [...prevMessages, aiMessage]);
       
       setMessageIdCounter(newAiMessageId + 1); // Update counter for next messages
     } catch (error) {
@@ -242,29 +196,6 @@ const BookingChatScreen = ({ navigateTo }) => {
     }, 100);
   };
 
-  // Function to extract booking summary data from message
-  const extractBookingSummary = (message) => {
-    const startTag = "<[BOOKING_SUMMARY]>";
-    const endTag = "</[BOOKING_SUMMARY]>";
-    
-    const startIndex = message.indexOf(startTag);
-    if (startIndex === -1) return null;
-    
-    const endIndex = message.indexOf(endTag);
-    if (endIndex === -1) return null;
-    
-    const jsonStart = startIndex + startTag.length;
-    const jsonEnd = endIndex;
-    const jsonString = message.substring(jsonStart, jsonEnd).trim();
-    
-    try {
-      return JSON.parse(jsonString);
-    } catch (e) {
-      console.error("Error parsing booking summary JSON:", e);
-      return null;
-    }
-  };
-
   return (
     <div className="relative flex size-full min-h-screen flex-col justify-between overflow-x-hidden bg-white">
       <div className="flex-1 overflow-y-auto">
@@ -300,65 +231,93 @@ const BookingChatScreen = ({ navigateTo }) => {
                 )}
                 <div className={`rounded-2xl px-4 py-3 max-w-[100%] ${message.sender === 'user' ? 'bg-green-500 text-white rounded-br-lg' : 'bg-gray-100 text-gray-900 rounded-bl-lg'}`}>
                   {message.text}
-                  {/* Render house options if they exist */}
-                  {message.houses && message.houses.length > 0 && (
-                    <div className="mt-3 space-y-3">
-                      {message.houses.map((house) => (
-                        <div
-                          key={house.id}
-                          className="border border-gray-200 rounded-lg p-3 bg-white cursor-pointer hover:bg-gray-50 transition-colors"
-                          onClick={() => handleHouseSelection(house)}
-                        >
-                          <div className="flex items-center gap-3">
-                            <img
-                              src={house.image_url}
-                              alt={house.name}
-                              className="w-16 h-16 rounded-md object-cover"
-                            />
-                            <div className="flex-1">
-                              <h3 className="font-semibold text-gray-900">{house.name}</h3>
-                              <p className="text-sm text-gray-600">{house.guests} guests • ${house.price_per_night}/night</p>
+                  {message.parts && message.parts.map((part, index) => (
+                    <React.Fragment key={index}>
+                      {part.type === 'text' && (
+                        <p className="whitespace-pre-line">{part.text.trim()}</p>
+                      )}
+
+                      {/* House options are rendered as selectable cards */}
+                      {part.type === 'house_options' && part.houses && part.houses.length > 0 && (
+                        <div className="mt-3 space-y-3">
+                          {part.houses.map((house) => (
+                            <div
+                              key={house.id}
+                              className="border border-gray-200 rounded-lg p-3 bg-white cursor-pointer hover:bg-gray-50 transition-colors"
+                              onClick={() => handleHouseSelection(house)}
+                            >
+                              <div className="flex items-center gap-3">
+                                <img
+                                  src={house.image_url}
+                                  alt={house.name}
+                                  className="w-16 h-16 rounded-md object-cover"
+                                />
+                                <div className="flex-1">
+                                  <h3 className="font-semibold text-gray-900">{house.name}</h3>
+                                  <p className="text-sm text-gray-600">{house.guests} guests • ${house.price_per_night}/night</p>
+                                </div>
+                              </div>
                             </div>
-                          </div>
-                        </div>
-                      ))}
-                    </div>
-                  )}
-                  
-                  {/* Render booking summary if it exists */}
-                  {message.bookingSummary && (
-                    <div className="mt-4 border border-gray-200 rounded-lg p-4 bg-white">
-                      <h3 className="text-lg font-semibold text-gray-800 mb-3">Booking Summary</h3>
-                      <div className="space-y-2 mb-4">
-                        <div className="flex justify-between">
-                          <span className="text-gray-600">Date:</span>
-                          <span className="font-medium">{message.bookingSummary.date}</span>
+                          ))}
                         </div>
-                        <div className="flex justify-between">
-                          <span className="text-gray-600">Guests:</span>
-                          <span className="font-medium">{message.bookingSummary.guests} people</span>
+                      )}
+
+                      {part.type === 'booking_summary' && part.summary && (
+                        <div className="mt-4 border border-gray-200 rounded-lg p-4 bg-white">
+                          <h3 className="text-lg font-semibold text-gray-800 mb-3">Booking Summary</h3>
+                          <div className="space-y-2 mb-4">
+                            <div className="flex justify-between">
+                              <span className="text-gray-600">Date:</span>
+                              <span className="font-medium">{part.summary.check_in}</span>
+                            </div>
+                            {part.summary.check_out && (
+                              <div className="flex justify-between">
+                                <span className="text-gray-600">Check-out:</span>
+                                <span className="font-medium">{part.summary.check_out} ({part.summary.nights} nights)</span>
+                              </div>
+                            )}
+                            <div className="flex justify-between">
+                              <span className="text-gray-600">Guests:</span>
+                              <span className="font-medium">{part.summary.guests} people</span>
+                            </div>
+                            <div className="flex justify-between">
+                              <span className="text-gray-600">House Type:</span>
+                              <span className="font-medium">{part.summary.house_name}</span>
+                            </div>
+                            {part.summary.total_price != null && (
+                              <div className="flex justify-between">
+                                <span className="text-gray-600">Total Price:</span>
+                                <span className="font-medium">${part.summary.total_price}</span>
+                              </div>
+                            )}
+                          </div>
+                          <div className="flex space-x-3">
+                            <button
+                              onClick={handleBookingCancel}
+                              className="flex-1 bg-gray-200 hover:bg-gray-300 text-gray-800 font-medium py-2 px-3 rounded-lg transition duration-200 text-sm"
+                            >
+                              Cancel
+                            </button>
+                            <button
+                              onClick={handleBookingConfirm}
+                              className="flex-1 bg-green-500 hover:bg-green-600 text-white font-medium py-2 px-3 rounded-lg transition duration-200 text-sm"
+                            >
+                              Confirm
+                            </button>
+                          </div>
                         </div>
-                        <div className="flex justify-between">
-                          <span className="text-gray-600">House Type:</span>
-                          <span className="font-medium">{message.bookingSummary.houseType}</span>
+                      )}
+
+                      {part.type === 'booking_confirmation' && part.confirmation && (
+                        <div className="mt-4 border border-green-200 rounded-lg p-4 bg-white">
+                          <h3 className="text-lg font-semibold text-gray-800 mb-1">Booking #{part.confirmation.booking_id}</h3>
+                          <p className="text-sm text-gray-600">
+                            {part.confirmation.house_name} • {part.confirmation.check_in} to {part.confirmation.check_out} • ${part.confirmation.total_price} • {part.confirmation.status}
+                          </p>
                         </div>
-                      </div>
-                      <div className="flex space-x-3">
-                        <button
-                          onClick={handleBookingCancel}
-                          className="flex-1 bg-gray-200 hover:bg-gray-300 text-gray-800 font-medium py-2 px-3 rounded-lg transition duration-200 text-sm"
-                        >
-                          Cancel
-                        </button>
-                        <button
-                          onClick={handleBookingConfirm}
-                          className="flex-1 bg-green-500 hover:bg-green-600 text-white font-medium py-2 px-3 rounded-lg transition duration-200 text-sm"
-                        >
-                          Confirm
-                        </button>
-                      </div>
-                    </div>
-                  )}
+                      )}
+                    </React.Fragment>
+                  ))}
                 </div>
                 <p className="text-gray-500 text-xs mt-1">
                   {formatDateTime(message.timestamp)}
@@ -1,7 +1,7 @@
 import React from 'react';
 
 const BookingSummaryStep = ({ bookingData, onConfirm, onCancel }) => {
-  const { date, guests, houseType } = bookingData;
+  const { date, checkOut, nights, guests, houseType, totalPrice } = bookingData;
 
   return (
     <div className="rounded-2xl px-4 py-3 max-w-[100%] bg-gray-100 text-gray-900 rounded-bl-lg">
@@ -13,6 +13,12 @@ const BookingSummaryStep = ({ bookingData, onConfirm, onCancel }) => {
             <span className="text-gray-600">Date:</span>
             <span className="font-medium">{date}</span>
           </div>
+          {checkOut && (
+            <div className="flex justify-between">
+              <span className="text-gray-600">Check-out:</span>
+              <span className="font-medium">{checkOut} ({nights} nights)</span>
+            </div>
+          )}
           <div className="flex justify-between">
             <span className="text-gray-600">Guests:</span>
             <span className="font-medium">{guests} people</span>
@@ -21,6 +27,12 @@ const BookingSummaryStep = ({ bookingData, onConfirm, onCancel }) => {
             <span className="text-gray-600">House Type:</span>
             <span className="font-medium">{houseType}</span>
           </div>
+          {totalPrice != null && (
+            <div className="flex justify-between">
+              <span className="text-gray-600">Total Price:</span>
+              <span className="font-medium">${totalPrice}</span>
+            </div>
+          )}
         </div>
         <div className="flex space-x-3">
           <button
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Staff roles, from most to least privileged
+const (
+	RoleAdmin        = "admin"        // everything, including staff accounts and the house catalog
+	RoleReceptionist = "receptionist" // reads and manages bookings, cannot delete them
+	RoleReadOnly     = "read_only"    // reads bookings
+)
+
+// Roles lists every staff role
+var Roles = []string{RoleAdmin, RoleReceptionist, RoleReadOnly}
+
+// IsValidRole checks if a role is one of Roles
+func IsValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources of an Identity
+const (
+	SourceStaffSession     = "staff_session"     // a session token from /api/auth/login
+	SourceCloudflareAccess = "cloudflare_access" // a Cloudflare Access token
+)
+
+// Identity is the authenticated caller of a request. Role is empty for Access identities
+// that no role is mapped to.
+type Identity struct {
+	StaffID  int      `json:"staff_id,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Role     string   `json:"role"`
+	Source   string   `json:"source"`
+}
+
+// identityKey is the gin context key of the Identity
+const identityKey = "auth.identity"
+
+// SetIdentity records the authenticated caller of the request
+func SetIdentity(c *gin.Context, identity *Identity) {
+	c.Set(identityKey, identity)
+}
+
+// GetIdentity returns the authenticated caller of the request, nil when it is anonymous
+func GetIdentity(c *gin.Context) *Identity {
+	if value, ok := c.Get(identityKey); ok {
+		if identity, ok := value.(*Identity); ok {
+			return identity
+		}
+	}
+	return nil
+}
+
+// RequireRole returns a middleware that only lets callers with one of roles through.
+// Anonymous callers get 401, callers with another role get 403.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := GetIdentity(c)
+		if identity == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		for _, role := range roles {
+			if identity.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	}
+}
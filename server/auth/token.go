@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for session tokens that are malformed, forged or expired
+var ErrInvalidToken = errors.New("invalid or expired session token")
+
+// TokenClaims is the content of a session token
+type TokenClaims struct {
+	StaffID   int    `json:"sub"`
+	Username  string `json:"usr"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenSigner issues and verifies session tokens signed with HMAC-SHA256. A token is
+// the base64url encoded claims and their signature, separated by a dot.
+type TokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokenSigner creates a signer whose tokens are valid for ttl
+func NewTokenSigner(secret []byte, ttl time.Duration) *TokenSigner {
+	return &TokenSigner{secret: secret, ttl: ttl}
+}
+
+// Issue creates a session token for a staff account
+func (s *TokenSigner) Issue(staffID int, username string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+	payload, err := json.Marshal(TokenClaims{StaffID: staffID, Username: username, IssuedAt: now.Unix(), ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.sign(encoded), expiresAt, nil
+}
+
+// Verify checks the signature and expiry of a session token and returns its claims
+func (s *TokenSigner) Verify(token string) (*TokenClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.StaffID == 0 {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// sign returns the base64url encoded signature of an encoded payload
+func (s *TokenSigner) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
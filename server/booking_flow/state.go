@@ -0,0 +1,444 @@
+package booking_flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"resort-app-server/models"
+	"resort-app-server/phone_number"
+)
+
+// Step is a step of the booking dialogue
+type Step string
+
+// The booking dialogue steps, in the order they must be completed
+const (
+	StepCheckIn     Step = "check_in"
+	StepCheckOut    Step = "check_out"
+	StepGuests      Step = "guests"
+	StepHouse       Step = "house"
+	StepSummary     Step = "summary"
+	StepContact     Step = "contact"
+	StepVerifyPhone Step = "verify_phone"
+	StepConfirm     Step = "confirm"
+	StepCompleted   Step = "completed"
+)
+
+// State tracks the booking slots collected in a conversation.
+// Slots can only be filled in order, so the model cannot skip or reorder steps.
+type State struct {
+	CheckIn          string `json:"check_in,omitempty"`
+	CheckOut         string `json:"check_out,omitempty"`
+	Guests           int    `json:"guests,omitempty"`
+	HouseID          int    `json:"house_id,omitempty"`
+	HouseName        string `json:"house_name,omitempty"`
+	HouseCapacity    int    `json:"house_capacity,omitempty"`
+	SummaryConfirmed bool   `json:"summary_confirmed,omitempty"`
+	CustomerName     string `json:"customer_name,omitempty"`
+	PhoneNumber      string `json:"phone_number,omitempty"`
+	PhoneVerified    bool   `json:"phone_verified,omitempty"`
+	BookingID        int    `json:"booking_id,omitempty"`
+	// SuggestedCheckIns are the check-in dates of the free stays offered when every house
+	// was booked, until a check-in date is set
+	SuggestedCheckIns []string `json:"suggested_check_ins,omitempty"`
+}
+
+// StepError reports a slot that was filled before the steps it depends on
+type StepError struct {
+	Attempted Step
+	Current   Step
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("cannot complete step %q yet, the current step is %q", e.Attempted, e.Current)
+}
+
+// Load decodes a stored state, an empty string is a new conversation
+func Load(data string) (*State, error) {
+	state := &State{}
+	if data == "" {
+		return state, nil
+	}
+
+	if err := json.Unmarshal([]byte(data), state); err != nil {
+		return nil, fmt.Errorf("invalid booking state: %v", err)
+	}
+
+	return state, nil
+}
+
+// Encode serializes the state for storage
+func (s *State) Encode() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// CurrentStep returns the first step that is not completed yet
+func (s *State) CurrentStep() Step {
+	switch {
+	case s.BookingID != 0:
+		return StepCompleted
+	case s.CheckIn == "":
+		return StepCheckIn
+	case s.CheckOut == "":
+		return StepCheckOut
+	case s.Guests == 0:
+		return StepGuests
+	case s.HouseName == "":
+		return StepHouse
+	case !s.SummaryConfirmed:
+		return StepSummary
+	case s.CustomerName == "" || s.PhoneNumber == "":
+		return StepContact
+	case !s.PhoneVerified:
+		return StepVerifyPhone
+	default:
+		return StepConfirm
+	}
+}
+
+// MissingSlots lists the slots that still have to be filled
+func (s *State) MissingSlots() []string {
+	var missing []string
+	if s.CheckIn == "" {
+		missing = append(missing, "check_in")
+	}
+	if s.CheckOut == "" {
+		missing = append(missing, "check_out")
+	}
+	if s.Guests == 0 {
+		missing = append(missing, "guests")
+	}
+	if s.HouseName == "" {
+		missing = append(missing, "house")
+	}
+	if !s.SummaryConfirmed {
+		missing = append(missing, "summary_confirmed")
+	}
+	if s.CustomerName == "" {
+		missing = append(missing, "customer_name")
+	}
+	if s.PhoneNumber == "" {
+		missing = append(missing, "phone_number")
+	}
+	if !s.PhoneVerified {
+		missing = append(missing, "phone_verified")
+	}
+	return missing
+}
+
+// MaxNights is the longest stay that can be booked in the chat
+const MaxNights = 30
+
+// stepOrder gives the position of each step in the dialogue
+var stepOrder = map[Step]int{
+	StepCheckIn:     0,
+	StepCheckOut:    1,
+	StepGuests:      2,
+	StepHouse:       3,
+	StepSummary:     4,
+	StepContact:     5,
+	StepVerifyPhone: 6,
+	StepConfirm:     7,
+	StepCompleted:   8,
+}
+
+// requireStep fails unless every step before step has been completed
+func (s *State) requireStep(step Step) error {
+	current := s.CurrentStep()
+	if current == StepCompleted {
+		return fmt.Errorf("the booking is already saved with ID %d", s.BookingID)
+	}
+	if stepOrder[current] < stepOrder[step] {
+		return &StepError{Attempted: step, Current: current}
+	}
+	return nil
+}
+
+// SetCheckIn fills the check-in date, given in YYYY-MM-DD format
+func (s *State) SetCheckIn(date string, today time.Time) error {
+	if err := s.requireStep(StepCheckIn); err != nil {
+		return err
+	}
+
+	checkIn, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("invalid check-in date format: %s", date)
+	}
+
+	todayDate := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if checkIn.Before(todayDate) {
+		return fmt.Errorf("check-in date %s is in the past", date)
+	}
+
+	if s.CheckIn != date {
+		nights := s.Nights()
+		s.CheckIn = date
+		// The summary the user confirmed no longer matches
+		s.SummaryConfirmed = false
+		// The stay keeps its length, the check-out moves with the check-in
+		if nights > 0 {
+			s.CheckOut = checkIn.AddDate(0, 0, nights).Format("2006-01-02")
+		}
+	}
+	s.SuggestedCheckIns = nil
+	return nil
+}
+
+// SuggestCheckIns records the check-in dates of the free stays offered to the user
+func (s *State) SuggestCheckIns(dates []string) {
+	s.SuggestedCheckIns = dates
+}
+
+// IsSuggestedCheckIn reports whether date is the check-in of a stay offered to the user
+func (s *State) IsSuggestedCheckIn(date string) bool {
+	for _, suggested := range s.SuggestedCheckIns {
+		if suggested == date {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCheckOut fills the check-out date, given in YYYY-MM-DD format
+func (s *State) SetCheckOut(date string) error {
+	if err := s.requireStep(StepCheckOut); err != nil {
+		return err
+	}
+
+	checkOut, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("invalid check-out date format: %s", date)
+	}
+
+	checkIn, _ := time.Parse("2006-01-02", s.CheckIn)
+	if !checkOut.After(checkIn) {
+		return fmt.Errorf("check-out date %s must be after the check-in date %s", date, s.CheckIn)
+	}
+	if checkOut.Sub(checkIn) > MaxNights*24*time.Hour {
+		return fmt.Errorf("a stay can be at most %d nights", MaxNights)
+	}
+
+	if s.CheckOut != date {
+		s.CheckOut = date
+		s.SummaryConfirmed = false
+	}
+	return nil
+}
+
+// SetNights fills the check-out date from the number of nights after the check-in
+func (s *State) SetNights(nights int) error {
+	if err := s.requireStep(StepCheckOut); err != nil {
+		return err
+	}
+
+	if nights <= 0 {
+		return fmt.Errorf("number of nights must be greater than 0")
+	}
+
+	checkIn, _ := time.Parse("2006-01-02", s.CheckIn)
+	return s.SetCheckOut(checkIn.AddDate(0, 0, nights).Format("2006-01-02"))
+}
+
+// Nights returns the length of the stay, or 0 while the dates are incomplete
+func (s *State) Nights() int {
+	if s.CheckIn == "" || s.CheckOut == "" {
+		return 0
+	}
+	checkIn, _ := time.Parse("2006-01-02", s.CheckIn)
+	checkOut, _ := time.Parse("2006-01-02", s.CheckOut)
+	return int(checkOut.Sub(checkIn).Hours() / 24)
+}
+
+// SetGuests fills the number of guests
+func (s *State) SetGuests(guests int) error {
+	if err := s.requireStep(StepGuests); err != nil {
+		return err
+	}
+
+	if guests <= 0 {
+		return fmt.Errorf("number of guests must be greater than 0")
+	}
+
+	if s.Guests != guests {
+		s.Guests = guests
+		s.SummaryConfirmed = false
+		// A house that is too small has to be chosen again
+		if s.HouseName != "" && s.HouseCapacity < guests {
+			s.HouseID, s.HouseName, s.HouseCapacity = 0, "", 0
+		}
+	}
+	return nil
+}
+
+// SelectHouse fills the house chosen from the catalog
+func (s *State) SelectHouse(house *models.House) error {
+	if err := s.requireStep(StepHouse); err != nil {
+		return err
+	}
+
+	if house.Guests < s.Guests {
+		return fmt.Errorf("%s accommodates at most %d guests, but the booking is for %d", house.Name, house.Guests, s.Guests)
+	}
+
+	if s.HouseID != house.ID {
+		s.HouseID, s.HouseName, s.HouseCapacity = house.ID, house.Name, house.Guests
+		s.SummaryConfirmed = false
+	}
+	return nil
+}
+
+// ReleaseHouse clears the selected house, e.g. when another guest booked it in the meantime
+func (s *State) ReleaseHouse() {
+	s.HouseID, s.HouseName, s.HouseCapacity = 0, "", 0
+	s.SummaryConfirmed = false
+}
+
+// ConfirmSummary records that the user confirmed the booking summary
+func (s *State) ConfirmSummary() error {
+	if err := s.requireStep(StepSummary); err != nil {
+		return err
+	}
+
+	s.SummaryConfirmed = true
+	return nil
+}
+
+// SetContact fills the customer's name and phone number, which is kept in E.164 form
+func (s *State) SetContact(name, phone string) error {
+	if err := s.requireStep(StepContact); err != nil {
+		return err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("customer name is required")
+	}
+
+	phone, err := phone_number.Normalize(phone)
+	if err != nil {
+		return err
+	}
+
+	s.CustomerName = name
+	if s.PhoneNumber != phone {
+		s.PhoneNumber = phone
+		// A new number has to be verified again
+		s.PhoneVerified = false
+	}
+	return nil
+}
+
+// VerifyPhone records that the customer entered the code sent to their phone number
+func (s *State) VerifyPhone() error {
+	if err := s.requireStep(StepVerifyPhone); err != nil {
+		return err
+	}
+
+	s.PhoneVerified = true
+	return nil
+}
+
+// Reset clears every slot so the dialogue restarts from the first step
+func (s *State) Reset() {
+	*s = State{}
+}
+
+// ValidateBooking checks that every step was completed and that the booking
+// matches the slots collected in the conversation
+func (s *State) ValidateBooking(houseName, checkIn, checkOut string, guests int) error {
+	if err := s.requireStep(StepConfirm); err != nil {
+		if _, skipped := err.(*StepError); skipped {
+			return fmt.Errorf("%v, missing: %s", err, strings.Join(s.MissingSlots(), ", "))
+		}
+		return err
+	}
+
+	if !strings.EqualFold(houseName, s.HouseName) {
+		return fmt.Errorf("house %q does not match the selected house %q", houseName, s.HouseName)
+	}
+	if checkIn != s.CheckIn {
+		return fmt.Errorf("check-in date %s does not match the confirmed date %s", checkIn, s.CheckIn)
+	}
+	if checkOut != s.CheckOut {
+		return fmt.Errorf("check-out date %s does not match the confirmed date %s", checkOut, s.CheckOut)
+	}
+	if guests != s.Guests {
+		return fmt.Errorf("%d guests does not match the confirmed %d guests", guests, s.Guests)
+	}
+
+	return nil
+}
+
+// Complete records the saved booking, which ends the dialogue
+func (s *State) Complete(bookingID int) {
+	s.BookingID = bookingID
+}
+
+// Summary describes the state for the model
+func (s *State) Summary() map[string]interface{} {
+	return map[string]interface{}{
+		"current_step":  s.CurrentStep(),
+		"missing_slots": s.MissingSlots(),
+		"slots":         s,
+	}
+}
+
+// Instructions tells the model where the dialogue stands, it is sent on every turn
+func (s *State) Instructions() string {
+	step := s.CurrentStep()
+	if step == StepCompleted {
+		return fmt.Sprintf("BOOKING STATE: the booking is saved with ID %d. Do not save it again.", s.BookingID)
+	}
+
+	var filled []string
+	if s.CheckIn != "" {
+		filled = append(filled, "check_in="+s.CheckIn)
+	}
+	if s.CheckOut != "" {
+		filled = append(filled, fmt.Sprintf("check_out=%s (%d nights)", s.CheckOut, s.Nights()))
+	}
+	if s.Guests != 0 {
+		filled = append(filled, fmt.Sprintf("guests=%d", s.Guests))
+	}
+	if s.HouseName != "" {
+		filled = append(filled, "house="+s.HouseName)
+	}
+	if s.SummaryConfirmed {
+		filled = append(filled, "summary_confirmed=true")
+	}
+	if s.CustomerName != "" {
+		filled = append(filled, "customer_name="+s.CustomerName)
+	}
+	if s.PhoneNumber != "" {
+		filled = append(filled, "phone_number="+s.PhoneNumber)
+	}
+	if s.PhoneVerified {
+		filled = append(filled, "phone_verified=true")
+	}
+	if len(filled) == 0 {
+		filled = append(filled, "none")
+	}
+
+	return fmt.Sprintf("BOOKING STATE: current step is %q. Filled slots: %s. Missing slots: %s. Only ask for the current step.",
+		step, strings.Join(filled, ", "), strings.Join(s.MissingSlots(), ", "))
+}
+
+type contextKey struct{}
+
+// WithState attaches the conversation's booking state to a context
+func WithState(ctx context.Context, state *State) context.Context {
+	return context.WithValue(ctx, contextKey{}, state)
+}
+
+// FromContext returns the booking state attached to a context, or nil
+func FromContext(ctx context.Context) *State {
+	state, _ := ctx.Value(contextKey{}).(*State)
+	return state
+}
@@ -0,0 +1,97 @@
+package booking_lifecycle
+
+import (
+	"fmt"
+	"time"
+
+	"resort-app-server/models"
+)
+
+// Booking statuses
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusPaid       = "paid"
+	StatusCheckedIn  = "checked_in"
+	StatusCheckedOut = "checked_out"
+	StatusCancelled  = "cancelled"
+	StatusNoShow     = "no_show"
+)
+
+// transitions lists the statuses each status can move to.
+// checked_out, cancelled and no_show are final.
+var transitions = map[string][]string{
+	StatusPending:    {StatusConfirmed, StatusCancelled},
+	StatusConfirmed:  {StatusPaid, StatusCancelled, StatusNoShow},
+	StatusPaid:       {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn:  {StatusCheckedOut},
+	StatusCheckedOut: {},
+	StatusCancelled:  {},
+	StatusNoShow:     {},
+}
+
+// TransitionError reports a status change the lifecycle does not allow
+type TransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("booking is %s and can no longer change status", e.From)
+	}
+	return fmt.Sprintf("booking cannot move from %s to %s, allowed: %v", e.From, e.To, e.Allowed)
+}
+
+// IsValidStatus reports whether status is one of the booking statuses
+func IsValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// IsActive reports whether a booking with the status still holds its house
+func IsActive(status string) bool {
+	return status != StatusCancelled && status != StatusNoShow
+}
+
+// AllowedTransitions returns the statuses a booking can move to from status
+func AllowedTransitions(status string) []string {
+	return transitions[status]
+}
+
+// CanTransition reports whether a booking can move from one status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves a booking to a new status and records when it happened,
+// e.g. the payment date when it is paid
+func Transition(booking *models.Booking, to string, now time.Time) error {
+	if !IsValidStatus(to) {
+		return fmt.Errorf("invalid booking status: %s", to)
+	}
+	if !CanTransition(booking.Status, to) {
+		return &TransitionError{From: booking.Status, To: to, Allowed: AllowedTransitions(booking.Status)}
+	}
+
+	timestamp := now.Format(time.RFC3339)
+	switch to {
+	case StatusPaid:
+		booking.PaymentDate = now.Format("2006-01-02")
+	case StatusCheckedIn:
+		booking.CheckedInAt = timestamp
+	case StatusCheckedOut:
+		booking.CheckedOutAt = timestamp
+	case StatusCancelled:
+		booking.CancelledAt = timestamp
+	}
+
+	booking.Status = to
+	return nil
+}
@@ -0,0 +1,47 @@
+package booking_ref
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// Prefix starts every reference code
+const Prefix = "BLI-"
+
+// codeLength is the number of random characters after the prefix, 30^6 is about 729 million codes
+const codeLength = 6
+
+// alphabet leaves out 0, 1, I, L, O and U, which are easily misread or mistyped
+const alphabet = "23456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// New returns a random reference code such as BLI-7XK2QF. The codes are not sequential
+// and cannot be guessed from other bookings.
+func New() (string, error) {
+	code := make([]byte, codeLength)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+	return Prefix + string(code), nil
+}
+
+// Normalize returns a reference code as typed by a guest in its canonical form, it ignores
+// case, spaces and a missing dash. It returns "" when ref cannot be a reference code.
+func Normalize(ref string) string {
+	ref = strings.ToUpper(strings.Join(strings.Fields(ref), ""))
+	ref = strings.TrimPrefix(strings.TrimPrefix(ref, "BLI"), "-")
+	if len(ref) != codeLength {
+		return ""
+	}
+	for _, r := range ref {
+		if !strings.ContainsRune(alphabet, r) {
+			return ""
+		}
+	}
+	return Prefix + ref
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"resort-app-server/booking_flow"
+	"resort-app-server/models"
+	"resort-app-server/pricing"
+	"resort-app-server/repository"
+	"resort-app-server/tool_calling/function_calling"
+)
+
+// Chat response part types
+const (
+	PartText                = "text"
+	PartHouseOptions        = "house_options"
+	PartBookingSummary      = "booking_summary"
+	PartBookingConfirmation = "booking_confirmation"
+)
+
+// The model marks the booking summary with these tags, they never reach the client
+const (
+	summaryStartTag = "<[BOOKING_SUMMARY]>"
+	summaryEndTag   = "</[BOOKING_SUMMARY]>"
+)
+
+// ChatResponse is the reply to a chat turn, an ordered list of typed parts
+type ChatResponse struct {
+	SessionID string     `json:"session_id"`
+	Parts     []ChatPart `json:"parts"`
+}
+
+// ChatPart is one typed part of a reply, only the field matching Type is set
+type ChatPart struct {
+	Type         string                         `json:"type"`
+	Text         string                         `json:"text,omitempty"`
+	Houses       []function_calling.HouseOption `json:"houses,omitempty"`
+	Summary      *BookingSummary                `json:"summary,omitempty"`
+	Confirmation *BookingConfirmation           `json:"confirmation,omitempty"`
+}
+
+// BookingSummary is the booking the user is asked to confirm
+type BookingSummary struct {
+	CheckIn    string  `json:"check_in"`
+	CheckOut   string  `json:"check_out,omitempty"`
+	Nights     int     `json:"nights,omitempty"`
+	Guests     int     `json:"guests"`
+	HouseName  string  `json:"house_name"`
+	TotalPrice float64 `json:"total_price,omitempty"`
+}
+
+// BookingConfirmation describes a booking saved during the chat
+type BookingConfirmation struct {
+	BookingID  int     `json:"booking_id"`
+	Reference  string  `json:"reference"`
+	Status     string  `json:"status"`
+	HouseName  string  `json:"house_name"`
+	CheckIn    string  `json:"check_in"`
+	CheckOut   string  `json:"check_out"`
+	Guests     int     `json:"guests"`
+	TotalPrice float64 `json:"total_price"`
+}
+
+// modelSummary is the JSON the model writes between the summary tags
+type modelSummary struct {
+	Date       string  `json:"date"`
+	CheckOut   string  `json:"checkOut"`
+	Nights     int     `json:"nights"`
+	Guests     int     `json:"guests"`
+	HouseType  string  `json:"houseType"`
+	TotalPrice float64 `json:"totalPrice"`
+}
+
+// replyBuilder turns the assistant's text and the tool results of a turn into parts.
+// Text can be written in arbitrary deltas; summary tags are removed even when they are
+// split across deltas, and onText and onPart, when set, are told about the text and
+// parts as soon as they are final.
+type replyBuilder struct {
+	parts     []ChatPart
+	pending   string
+	inSummary bool
+	state     *booking_flow.State
+	houses    repository.HouseStore
+	onText    func(string)
+	onPart    func(ChatPart)
+}
+
+// Write adds assistant text
+func (b *replyBuilder) Write(delta string) {
+	b.pending += delta
+	for {
+		if b.inSummary {
+			end := strings.Index(b.pending, summaryEndTag)
+			if end == -1 {
+				return
+			}
+			b.addPart(ChatPart{Type: PartBookingSummary, Summary: b.parseSummary(b.pending[:end])})
+			b.pending = b.pending[end+len(summaryEndTag):]
+			b.inSummary = false
+			continue
+		}
+
+		start := strings.Index(b.pending, summaryStartTag)
+		if start == -1 {
+			// Hold back a trailing partial tag until the next delta shows what it is
+			keep := partialTagLength(b.pending, summaryStartTag)
+			b.addText(b.pending[:len(b.pending)-keep])
+			b.pending = b.pending[len(b.pending)-keep:]
+			return
+		}
+
+		b.addText(b.pending[:start])
+		b.pending = b.pending[start+len(summaryStartTag):]
+		b.inSummary = true
+	}
+}
+
+// EndMessage flushes the text of one assistant message, tags never span messages
+func (b *replyBuilder) EndMessage() {
+	if b.inSummary {
+		log.Println("Dropping unterminated booking summary from the AI response")
+	} else {
+		b.addText(b.pending)
+	}
+	b.pending, b.inSummary = "", false
+}
+
+// AddToolResult adds the structured output of a tool call, if it has any
+func (b *replyBuilder) AddToolResult(toolResult *function_calling.ToolResult) {
+	switch toolResult.Type {
+	case "house_options":
+		houses, _ := toolResult.Data.([]function_calling.HouseOption)
+		b.addPart(ChatPart{Type: PartHouseOptions, Houses: houses})
+	case "booking_created":
+		if booking, ok := toolResult.Data.(*models.Booking); ok {
+			b.addPart(ChatPart{Type: PartBookingConfirmation, Confirmation: &BookingConfirmation{
+				BookingID:  booking.ID,
+				Reference:  booking.Reference,
+				Status:     booking.Status,
+				HouseName:  booking.ResortName,
+				CheckIn:    booking.CheckIn,
+				CheckOut:   booking.CheckOut,
+				Guests:     booking.Guests,
+				TotalPrice: booking.TotalPrice,
+			}})
+		}
+	}
+}
+
+// Text returns the text parts joined together
+func (b *replyBuilder) Text() string {
+	var text strings.Builder
+	for _, part := range b.parts {
+		if part.Type == PartText {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+func (b *replyBuilder) addText(text string) {
+	if text == "" {
+		return
+	}
+	if b.onText != nil {
+		b.onText(text)
+	}
+	// Consecutive text is merged into one part
+	if last := len(b.parts) - 1; last >= 0 && b.parts[last].Type == PartText {
+		b.parts[last].Text += text
+		return
+	}
+	b.parts = append(b.parts, ChatPart{Type: PartText, Text: text})
+}
+
+func (b *replyBuilder) addPart(part ChatPart) {
+	b.parts = append(b.parts, part)
+	if b.onPart != nil {
+		b.onPart(part)
+	}
+}
+
+// parseSummary reads the summary written by the model. The booking state is the source
+// of truth, so its slots and the server-side quote replace what the model wrote.
+func (b *replyBuilder) parseSummary(raw string) *BookingSummary {
+	var written modelSummary
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &written); err != nil {
+		log.Printf("Invalid booking summary from the AI: %v", err)
+	}
+
+	summary := &BookingSummary{
+		CheckIn:    written.Date,
+		CheckOut:   written.CheckOut,
+		Nights:     written.Nights,
+		Guests:     written.Guests,
+		HouseName:  written.HouseType,
+		TotalPrice: written.TotalPrice,
+	}
+
+	state := b.state
+	if state == nil || state.HouseName == "" {
+		return summary
+	}
+
+	summary.CheckIn, summary.CheckOut, summary.Nights = state.CheckIn, state.CheckOut, state.Nights()
+	summary.Guests, summary.HouseName = state.Guests, state.HouseName
+	summary.TotalPrice = 0
+	if b.houses == nil {
+		return summary
+	}
+	if quote, err := pricing.QuoteByHouseName(b.houses, state.HouseName, state.CheckIn, state.CheckOut); err == nil {
+		summary.TotalPrice = quote.TotalPrice
+	}
+	return summary
+}
+
+// partialTagLength returns the length of the longest suffix of text that starts tag
+func partialTagLength(text, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if n <= len(text) && strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// stripSummaryTags removes the booking summary the model wrote from stored text
+func stripSummaryTags(text string) string {
+	builder := &replyBuilder{}
+	builder.Write(text)
+	builder.EndMessage()
+	return builder.Text()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"resort-app-server/config"
+)
+
+const configUsage = `usage: config <command>
+
+commands:
+  print  show the effective settings and where they came from, secrets redacted`
+
+// runConfigCommand runs the config subcommand and returns the exit code
+func runConfigCommand(cfg *config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE\tFILE KEY")
+	for _, setting := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", setting.Env, setting.Value, setting.Source, setting.Key)
+	}
+	w.Flush()
+
+	return 0
+}
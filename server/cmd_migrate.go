@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"resort-app-server/config"
+	"resort-app-server/database"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  up            apply every pending migration
+  down [steps]  revert the last steps migrations, 1 by default
+  status        list the migrations and whether they are applied`
+
+// runMigrateCommand runs the migrate subcommand and returns the exit code
+func runMigrateCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// The in-memory stores have no schema to manage
+	if database.IsMemoryURL(cfg.Database.URL) {
+		fmt.Fprintln(os.Stderr, "migrate: DATABASE_URL selects the in-memory stores, there is nothing to migrate")
+		return 1
+	}
+
+	db := database.Open(cfg.Database.URL, cfg.Database.Path)
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up:", err)
+			return 1
+		}
+		fmt.Printf("Applied %d migrations\n", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Fprintln(os.Stderr, "migrate down: steps must be a positive number")
+				return 2
+			}
+			steps = n
+		}
+
+		reverted, err := db.MigrateDown(steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down:", err)
+			return 1
+		}
+		fmt.Printf("Reverted %d migrations\n", len(reverted))
+
+	case "status":
+		statuses, err := db.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status:", err)
+			return 1
+		}
+		for _, status := range statuses {
+			name, appliedAt := status.Name, status.AppliedAt
+			if name == "" {
+				name = "(unknown to this server)"
+			}
+			if appliedAt == "" {
+				appliedAt = "pending"
+			}
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, name, appliedAt)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -2,30 +2,109 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"net/http"
-	"os"
+	"strings"
+
+	"resort-app-server/auth"
 
-	"github.com/gin-gonic/gin"
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
 )
 
 // CloudflareZeroTrustConfig holds the configuration for Cloudflare Zero Trust integration
 type CloudflareZeroTrustConfig struct {
-	TeamDomain string
-	PolicyAUD  string
-	Enabled    bool
+	Enabled      bool   `env:"CF_ZERO_TRUST_ENABLED" file:"enabled"`
+	TeamDomain   string `env:"CF_TEAM_DOMAIN" file:"team_domain"`
+	PolicyAUD    string `env:"CF_POLICY_AUD" file:"policy_aud"`
+	JWKSURL      string `env:"CF_JWKS_URL" file:"jwks_url"` // the team domain certs by default
+	RoleMap      string `env:"CF_ROLE_MAP" file:"role_map"` // parsed into RoleMappings by Config.Validate
+	RoleMappings []RoleMapping
+}
+
+// RoleMapping gives a role to the Access identities with one of the emails or groups.
+// An email starting with @ matches every address of that domain.
+type RoleMapping struct {
+	Role   string
+	Emails []string
+	Groups []string
+}
+
+// AccessClaims are the claims of a verified Cloudflare Access token used for authorization
+type AccessClaims struct {
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+}
+
+// ParseRoleMappings reads mappings such as
+// "admin=group:resort-admins,email:owner@example.com;read_only=email:@example.com"
+func ParseRoleMappings(value string) ([]RoleMapping, error) {
+	var mappings []RoleMapping
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		role, matchers, ok := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !ok || !auth.IsValidRole(role) {
+			return nil, fmt.Errorf("%q must start with one of %s followed by =", entry, strings.Join(auth.Roles, ", "))
+		}
+
+		mapping := RoleMapping{Role: role}
+		for _, matcher := range strings.Split(matchers, ",") {
+			kind, match, _ := strings.Cut(strings.TrimSpace(matcher), ":")
+			match = strings.TrimSpace(match)
+			switch {
+			case match == "":
+				return nil, fmt.Errorf("%q has an empty match for %s", entry, role)
+			case kind == "email":
+				mapping.Emails = append(mapping.Emails, strings.ToLower(match))
+			case kind == "group":
+				mapping.Groups = append(mapping.Groups, match)
+			default:
+				return nil, fmt.Errorf("%q must match email:<address> or group:<name>", matcher)
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// RoleFor returns the most privileged role mapped to the claims, or "" when none is
+func (cfg *CloudflareZeroTrustConfig) RoleFor(claims *AccessClaims) string {
+	email := strings.ToLower(claims.Email)
+	for _, role := range auth.Roles {
+		for _, mapping := range cfg.RoleMappings {
+			if mapping.Role == role && mapping.matches(email, claims.Groups) {
+				return role
+			}
+		}
+	}
+	return ""
 }
 
-// NewCloudflareZeroTrustConfig creates a new Cloudflare Zero Trust configuration
-func NewCloudflareZeroTrustConfig() *CloudflareZeroTrustConfig {
-	return &CloudflareZeroTrustConfig{
-		TeamDomain: os.Getenv("CF_TEAM_DOMAIN"),
-		PolicyAUD:  os.Getenv("CF_POLICY_AUD"),
-		Enabled:    os.Getenv("CF_ZERO_TRUST_ENABLED") == "true",
+// matches reports whether a lowercase email or one of the groups is in the mapping
+func (m *RoleMapping) matches(email string, groups []string) bool {
+	for _, match := range m.Emails {
+		if email != "" && (email == match || (strings.HasPrefix(match, "@") && strings.HasSuffix(email, match))) {
+			return true
+		}
+	}
+	for _, match := range m.Groups {
+		for _, group := range groups {
+			if group == match {
+				return true
+			}
+		}
 	}
+	return false
 }
 
-// ValidateCloudflareAccessJWT returns a Gin middleware for validating Cloudflare Access JWT tokens
+// ValidateCloudflareAccessJWT returns a Gin middleware for validating Cloudflare Access JWT tokens.
+// The verified identity is mapped to a role and recorded with auth.SetIdentity, unless
+// the request was already signed in with a staff session token.
 func (cfg *CloudflareZeroTrustConfig) ValidateCloudflareAccessJWT() gin.HandlerFunc {
 	// If Zero Trust is not enabled, return a no-op middleware
 	if !cfg.Enabled {
@@ -34,30 +113,15 @@ func (cfg *CloudflareZeroTrustConfig) ValidateCloudflareAccessJWT() gin.HandlerF
 		}
 	}
 
-	// Set default team domain if not provided
-	teamDomain := cfg.TeamDomain
-	if teamDomain == "" {
-		teamDomain = "https://your-team.cloudflareaccess.com" // Replace with your actual team domain
-	}
-
-	// Configure OIDC verifier
-	ctx := context.Background()
-	certsURL := teamDomain + "/cdn-cgi/access/certs"
-	
+	// Configure OIDC verifier, the keys are fetched on first use and when they rotate
 	config := &oidc.Config{
 		ClientID: cfg.PolicyAUD,
 	}
-	
-	keySet := oidc.NewRemoteKeySet(ctx, certsURL)
-	verifier := oidc.NewVerifier(teamDomain, keySet, config)
 
-	return func(c *gin.Context) {
-		// Skip validation for health check and root endpoints
-		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/" {
-			c.Next()
-			return
-		}
+	keySet := oidc.NewRemoteKeySet(context.Background(), cfg.JWKSURL)
+	verifier := oidc.NewVerifier(cfg.TeamDomain, keySet, config)
 
+	return func(c *gin.Context) {
 		// Get the CF Authorization token from headers
 		accessJWT := c.GetHeader("Cf-Access-Jwt-Assertion")
 		if accessJWT == "" {
@@ -68,23 +132,39 @@ func (cfg *CloudflareZeroTrustConfig) ValidateCloudflareAccessJWT() gin.HandlerF
 		}
 
 		if accessJWT == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Missing Cloudflare Access token",
 			})
-			c.Abort()
 			return
 		}
 
 		// Verify the access token
-		_, err := verifier.Verify(c.Request.Context(), accessJWT)
+		token, err := verifier.Verify(c.Request.Context(), accessJWT)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid Cloudflare Access token: " + err.Error(),
 			})
-			c.Abort()
 			return
 		}
 
+		var claims AccessClaims
+		if err := token.Claims(&claims); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid Cloudflare Access token claims",
+			})
+			return
+		}
+
+		// A staff session identifies the caller more precisely than the Access identity
+		if auth.GetIdentity(c) == nil {
+			auth.SetIdentity(c, &auth.Identity{
+				Email:  claims.Email,
+				Groups: claims.Groups,
+				Role:   cfg.RoleFor(&claims),
+				Source: auth.SourceCloudflareAccess,
+			})
+		}
+
 		c.Next()
 	}
-}
\ No newline at end of file
+}
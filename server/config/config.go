@@ -0,0 +1,580 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"resort-app-server/cors"
+	"resort-app-server/date_resolver"
+	"resort-app-server/llm"
+	"resort-app-server/phone_verification"
+	"resort-app-server/sms"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective configuration of the server. Every setting has an environment
+// variable, named by its env tag, and a key in the optional config file, named by the
+// file tags of its section and field. The environment, including the .env file, takes
+// precedence over the config file, which takes precedence over the defaults.
+type Config struct {
+	Server           ServerConfig              `file:"server"`
+	Database         DatabaseConfig            `file:"database"`
+	LLM              LLMConfig                 `file:"llm"`
+	Auth             AuthConfig                `file:"auth"`
+	CORS             CORSConfig                `file:"cors"`
+	CloudflareAccess CloudflareZeroTrustConfig `file:"cloudflare_access"`
+	Verification     PhoneVerificationConfig   `file:"phone_verification"`
+	SMS              SMSConfig                 `file:"sms"`
+	Resort           ResortConfig              `file:"resort"`
+
+	sources map[string]string // where each setting came from, by environment variable
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port    int    `env:"PORT" file:"port"`
+	GinMode string `env:"GIN_MODE" file:"gin_mode"` // debug, release or test
+	// IdempotencyKeyTTL is how long the response to a request with an Idempotency-Key is replayed
+	IdempotencyKeyTTL time.Duration `env:"IDEMPOTENCY_KEY_TTL" file:"idempotency_key_ttl"`
+}
+
+// DatabaseConfig selects the storage backend, see database.Open
+type DatabaseConfig struct {
+	URL            string `env:"DATABASE_URL" file:"url" secret:"url"`
+	Path           string `env:"DB_PATH" file:"path"` // SQLite database used when URL is empty
+	MigrateOnStart bool   `env:"MIGRATE_ON_START" file:"migrate_on_start"`
+}
+
+// LLMConfig holds the chat model settings
+type LLMConfig struct {
+	Provider         string  `env:"LLM_PROVIDER" file:"provider"` // openai, local or fake
+	APIKey           string  `env:"OPENAI_API_KEY" file:"api_key" secret:"true"`
+	BaseURL          string  `env:"OPENAI_BASE_URL" file:"base_url"`
+	Model            string  `env:"OPENAI_MODEL" file:"model"`
+	Temperature      float32 `env:"OPENAI_TEMPERATURE" file:"temperature"`
+	TopP             float32 `env:"OPENAI_TOP_P" file:"top_p"`
+	MaxTokens        int     `env:"OPENAI_MAX_TOKENS" file:"max_tokens"` // 0 means no limit
+	PresencePenalty  float32 `env:"OPENAI_PRESENCE_PENALTY" file:"presence_penalty"`
+	FrequencyPenalty float32 `env:"OPENAI_FREQUENCY_PENALTY" file:"frequency_penalty"`
+	FakeScript       string  `env:"LLM_FAKE_SCRIPT" file:"fake_script"`
+	LocalBaseURL     string  `env:"LOCAL_LLM_BASE_URL" file:"local_base_url"`
+	LocalModel       string  `env:"LOCAL_LLM_MODEL" file:"local_model"`
+}
+
+// AuthConfig holds the staff session settings
+type AuthConfig struct {
+	TokenSecret   string        `env:"AUTH_TOKEN_SECRET" file:"token_secret" secret:"true"` // random when empty
+	TokenTTL      time.Duration `env:"AUTH_TOKEN_TTL" file:"token_ttl"`
+	AdminUsername string        `env:"ADMIN_USERNAME" file:"admin_username"`
+	AdminPassword string        `env:"ADMIN_PASSWORD" file:"admin_password" secret:"true"`
+}
+
+// CORSConfig holds the cross-origin policy settings
+type CORSConfig struct {
+	AllowedOrigins []string `env:"ALLOWED_ORIGINS" file:"allowed_origins"`
+	AllowedHeaders []string `env:"CORS_ALLOWED_HEADERS" file:"allowed_headers"` // added to cors.DefaultAllowedHeaders
+}
+
+// PhoneVerificationConfig holds the settings of the one-time codes that verify the phone
+// number of chat bookings and guest lookups
+type PhoneVerificationConfig struct {
+	Enabled        bool          `env:"PHONE_VERIFICATION_ENABLED" file:"enabled"`
+	CodeTTL        time.Duration `env:"PHONE_VERIFICATION_CODE_TTL" file:"code_ttl"`
+	MaxAttempts    int           `env:"PHONE_VERIFICATION_MAX_ATTEMPTS" file:"max_attempts"`
+	ResendInterval time.Duration `env:"PHONE_VERIFICATION_RESEND_INTERVAL" file:"resend_interval"`
+}
+
+// SMSConfig selects how text messages are sent, see sms.New
+type SMSConfig struct {
+	Provider   string `env:"SMS_PROVIDER" file:"provider"` // log or twilio
+	LogFile    string `env:"SMS_LOG_FILE" file:"log_file"`
+	APIURL     string `env:"SMS_API_URL" file:"api_url"`
+	AccountSID string `env:"SMS_ACCOUNT_SID" file:"account_sid"`
+	AuthToken  string `env:"SMS_AUTH_TOKEN" file:"auth_token" secret:"true"`
+	From       string `env:"SMS_FROM" file:"from"`
+	Channel    string `env:"SMS_CHANNEL" file:"channel"` // sms or whatsapp
+}
+
+// ResortConfig holds the settings of the resort itself
+type ResortConfig struct {
+	Timezone string `env:"RESORT_TIMEZONE" file:"timezone"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Port: 8080, GinMode: "release", IdempotencyKeyTTL: 24 * time.Hour},
+		Database: DatabaseConfig{Path: filepath.Join("data", "resort.db"), MigrateOnStart: true},
+		LLM: LLMConfig{
+			Provider:         "openai",
+			Temperature:      0.1,
+			TopP:             0.3,
+			PresencePenalty:  0.1,
+			FrequencyPenalty: 0.3,
+		},
+		Auth: AuthConfig{TokenTTL: 12 * time.Hour, AdminUsername: "admin"},
+		CORS: CORSConfig{AllowedOrigins: []string{"https://okiabrian.my.id", "http://localhost:8085"}},
+		Verification: PhoneVerificationConfig{
+			// Derived from SMS_PROVIDER in Validate when not set
+			Enabled:        false,
+			CodeTTL:        10 * time.Minute,
+			MaxAttempts:    5,
+			ResendInterval: time.Minute,
+		},
+		SMS:    SMSConfig{Provider: "log", APIURL: sms.DefaultTwilioAPIURL, Channel: "sms"},
+		Resort: ResortConfig{Timezone: date_resolver.DefaultTimezone},
+	}
+}
+
+// Load reads the configuration from the defaults, the config file named by CONFIG_FILE,
+// the .env file and the environment, then validates it. The error lists every invalid
+// setting.
+func Load() (*Config, error) {
+	// The .env file of the repository root, or of the working directory, fills in the
+	// environment without overriding it
+	if err := godotenv.Load("../.env"); err != nil {
+		godotenv.Load(".env")
+	}
+
+	cfg := Default()
+	cfg.sources = make(map[string]string)
+	settings := cfg.settings()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+		cfg.sources[s.env] = "environment"
+		if err := s.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%s (%s): %v", s.env, value, cfg.Source(s.env), err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the settings that parsed but are out of range or inconsistent, and
+// fills in the settings derived from others. The error lists every invalid setting.
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(env string, value interface{}, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s=%v (%s): %s", env, value, cfg.Source(env), fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		invalid("PORT", cfg.Server.Port, "must be between 1 and 65535")
+	}
+	switch cfg.Server.GinMode {
+	case "debug", "release", "test":
+	default:
+		invalid("GIN_MODE", cfg.Server.GinMode, "must be debug, release or test")
+	}
+	if cfg.Server.IdempotencyKeyTTL <= 0 {
+		invalid("IDEMPOTENCY_KEY_TTL", cfg.Server.IdempotencyKeyTTL, "must be a positive duration such as 24h")
+	}
+
+	if databaseURL := cfg.Database.URL; databaseURL != "" && !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") &&
+		!strings.HasPrefix(databaseURL, "sqlite:") && !strings.HasPrefix(databaseURL, "memory:") {
+		invalid("DATABASE_URL", redactURL(databaseURL), "must start with postgres://, sqlite: or memory:")
+	}
+
+	llmCfg := &cfg.LLM
+	switch llmCfg.Provider {
+	case "openai", "local", "fake":
+	default:
+		invalid("LLM_PROVIDER", llmCfg.Provider, "must be openai, local or fake")
+	}
+	if llmCfg.Temperature < 0 || llmCfg.Temperature > 2 {
+		invalid("OPENAI_TEMPERATURE", llmCfg.Temperature, "must be between 0 and 2")
+	}
+	if llmCfg.TopP < 0 || llmCfg.TopP > 1 {
+		invalid("OPENAI_TOP_P", llmCfg.TopP, "must be between 0 and 1")
+	}
+	if llmCfg.MaxTokens < 0 {
+		invalid("OPENAI_MAX_TOKENS", llmCfg.MaxTokens, "must not be negative, 0 means no limit")
+	}
+	if llmCfg.PresencePenalty < -2 || llmCfg.PresencePenalty > 2 {
+		invalid("OPENAI_PRESENCE_PENALTY", llmCfg.PresencePenalty, "must be between -2 and 2")
+	}
+	if llmCfg.FrequencyPenalty < -2 || llmCfg.FrequencyPenalty > 2 {
+		invalid("OPENAI_FREQUENCY_PENALTY", llmCfg.FrequencyPenalty, "must be between -2 and 2")
+	}
+
+	if cfg.Auth.TokenTTL <= 0 {
+		invalid("AUTH_TOKEN_TTL", cfg.Auth.TokenTTL, "must be a positive duration such as 12h")
+	}
+	if cfg.Auth.AdminUsername == "" {
+		invalid("ADMIN_USERNAME", "", "must not be empty")
+	}
+
+	origins, err := cors.ParseOrigins(strings.Join(cfg.CORS.AllowedOrigins, ","))
+	if err != nil {
+		invalid("ALLOWED_ORIGINS", strings.Join(cfg.CORS.AllowedOrigins, ","), "%v", err)
+	}
+	cfg.CORS.AllowedOrigins = origins
+
+	access := &cfg.CloudflareAccess
+	access.TeamDomain = strings.TrimSuffix(access.TeamDomain, "/")
+	mappings, err := ParseRoleMappings(access.RoleMap)
+	if err != nil {
+		invalid("CF_ROLE_MAP", access.RoleMap, "%v", err)
+	}
+	access.RoleMappings = mappings
+	if access.Enabled {
+		if access.TeamDomain == "" {
+			invalid("CF_TEAM_DOMAIN", "", "is required when CF_ZERO_TRUST_ENABLED is true")
+		}
+		if access.PolicyAUD == "" {
+			invalid("CF_POLICY_AUD", "", "is required when CF_ZERO_TRUST_ENABLED is true")
+		}
+		// Access publishes its signing keys under the team domain
+		if access.JWKSURL == "" {
+			access.JWKSURL = access.TeamDomain + "/cdn-cgi/access/certs"
+		}
+	}
+
+	verification := &cfg.Verification
+	// The log sender does not reach guests, so verification is only on by default with a
+	// provider that does
+	if cfg.Source("PHONE_VERIFICATION_ENABLED") == "default" {
+		verification.Enabled = cfg.SMS.Provider != "log"
+	}
+	if verification.CodeTTL <= 0 {
+		invalid("PHONE_VERIFICATION_CODE_TTL", verification.CodeTTL, "must be a positive duration such as 10m")
+	}
+	if verification.MaxAttempts < 1 {
+		invalid("PHONE_VERIFICATION_MAX_ATTEMPTS", verification.MaxAttempts, "must be at least 1")
+	}
+	if verification.ResendInterval < 0 {
+		invalid("PHONE_VERIFICATION_RESEND_INTERVAL", verification.ResendInterval, "must not be negative")
+	}
+
+	smsCfg := &cfg.SMS
+	switch smsCfg.Provider {
+	case "log":
+	case "twilio":
+		if smsCfg.AccountSID == "" {
+			invalid("SMS_ACCOUNT_SID", "", "is required when SMS_PROVIDER is twilio")
+		}
+		if smsCfg.AuthToken == "" {
+			invalid("SMS_AUTH_TOKEN", "", "is required when SMS_PROVIDER is twilio")
+		}
+		if smsCfg.From == "" {
+			invalid("SMS_FROM", "", "is required when SMS_PROVIDER is twilio")
+		}
+	default:
+		invalid("SMS_PROVIDER", smsCfg.Provider, "must be log or twilio")
+	}
+	if _, err := url.ParseRequestURI(smsCfg.APIURL); err != nil || (!strings.HasPrefix(smsCfg.APIURL, "http://") && !strings.HasPrefix(smsCfg.APIURL, "https://")) {
+		invalid("SMS_API_URL", smsCfg.APIURL, "must be an http or https URL")
+	}
+	if smsCfg.Channel != "sms" && smsCfg.Channel != "whatsapp" {
+		invalid("SMS_CHANNEL", smsCfg.Channel, "must be sms or whatsapp")
+	}
+
+	if _, err := time.LoadLocation(cfg.Resort.Timezone); err != nil || cfg.Resort.Timezone == "" {
+		invalid("RESORT_TIMEZONE", cfg.Resort.Timezone, "must be an IANA timezone such as %s", date_resolver.DefaultTimezone)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Source returns where a setting came from: default, environment or the config file path
+func (cfg *Config) Source(env string) string {
+	if source, ok := cfg.sources[env]; ok {
+		return source
+	}
+	return "default"
+}
+
+// ProviderConfig returns the settings of the chat model provider. The local provider
+// has its own endpoint and model settings.
+func (c *LLMConfig) ProviderConfig() llm.Config {
+	providerCfg := llm.Config{
+		Provider:         c.Provider,
+		APIKey:           c.APIKey,
+		BaseURL:          c.BaseURL,
+		Model:            c.Model,
+		Temperature:      c.Temperature,
+		TopP:             c.TopP,
+		MaxTokens:        c.MaxTokens,
+		PresencePenalty:  c.PresencePenalty,
+		FrequencyPenalty: c.FrequencyPenalty,
+		FakeScriptPath:   c.FakeScript,
+	}
+	if c.Provider == "local" {
+		providerCfg.BaseURL = c.LocalBaseURL
+		providerCfg.Model = c.LocalModel
+	}
+	return providerCfg
+}
+
+// SenderConfig returns the settings of the text message sender
+func (c *SMSConfig) SenderConfig() sms.Config {
+	return sms.Config{
+		Provider:   c.Provider,
+		LogFile:    c.LogFile,
+		APIURL:     c.APIURL,
+		AccountSID: c.AccountSID,
+		AuthToken:  c.AuthToken,
+		From:       c.From,
+		Channel:    c.Channel,
+	}
+}
+
+// VerifierConfig returns the limits of the one-time codes
+func (c *PhoneVerificationConfig) VerifierConfig() phone_verification.Config {
+	return phone_verification.Config{
+		CodeTTL:        c.CodeTTL,
+		MaxAttempts:    c.MaxAttempts,
+		ResendInterval: c.ResendInterval,
+	}
+}
+
+// Policy returns the cross-origin policy of the server
+func (c *CORSConfig) Policy() *cors.Config {
+	return &cors.Config{
+		AllowedOrigins: c.AllowedOrigins,
+		AllowedHeaders: append(append([]string{}, cors.DefaultAllowedHeaders...), cors.ParseHeaders(strings.Join(c.AllowedHeaders, ","))...),
+		ExposedHeaders: cors.DefaultExposedHeaders,
+		AllowedMethods: cors.DefaultAllowedMethods,
+		MaxAge:         86400, // 24 hours
+	}
+}
+
+// Location returns the resort timezone, Validate has checked that it loads
+func (c *ResortConfig) Location() *time.Location {
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Setting is one effective setting, as shown by config print
+type Setting struct {
+	Env    string // environment variable
+	Key    string // key in the config file, section.name
+	Value  string // secrets are redacted
+	Source string
+}
+
+// Settings lists the effective settings in declaration order, with secrets redacted
+func (cfg *Config) Settings() []Setting {
+	var list []Setting
+	for _, s := range cfg.settings() {
+		value := s.String()
+		switch s.secret {
+		case "true":
+			if value != "" {
+				value = "********"
+			}
+		case "url":
+			value = redactURL(value)
+		}
+		list = append(list, Setting{Env: s.env, Key: s.key, Value: value, Source: cfg.Source(s.env)})
+	}
+	return list
+}
+
+// setting is a field of a section that can be set from a string
+type setting struct {
+	env    string
+	key    string
+	secret string
+	field  reflect.Value
+}
+
+// settings lists the settings of every section, in declaration order
+func (cfg *Config) settings() []setting {
+	var list []setting
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i).Tag.Get("file")
+		if section == "" {
+			continue
+		}
+
+		fields := root.Field(i)
+		for j := 0; j < fields.NumField(); j++ {
+			tag := fields.Type().Field(j).Tag
+			if tag.Get("env") == "" {
+				continue // derived from other settings
+			}
+			list = append(list, setting{
+				env:    tag.Get("env"),
+				key:    section + "." + tag.Get("file"),
+				secret: tag.Get("secret"),
+				field:  fields.Field(j),
+			})
+		}
+	}
+	return list
+}
+
+// durationType is the type of the settings parsed with time.ParseDuration
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses value into the setting. Lists are comma-separated.
+func (s *setting) set(value string) error {
+	switch {
+	case s.field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("must be a duration such as 30s or 12h")
+		}
+		s.field.SetInt(int64(d))
+	case s.field.Kind() == reflect.String:
+		s.field.SetString(value)
+	case s.field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		s.field.SetBool(b)
+	case s.field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		s.field.SetInt(int64(n))
+	case s.field.Kind() == reflect.Float32:
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		s.field.SetFloat(f)
+	case s.field.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s.field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.field.Type())
+	}
+	return nil
+}
+
+// String formats the setting the way set parses it
+func (s *setting) String() string {
+	switch {
+	case s.field.Type() == durationType:
+		return time.Duration(s.field.Int()).String()
+	case s.field.Kind() == reflect.Float32:
+		return strconv.FormatFloat(s.field.Float(), 'g', -1, 32)
+	case s.field.Kind() == reflect.Slice:
+		return strings.Join(s.field.Interface().([]string), ",")
+	default:
+		return fmt.Sprint(s.field.Interface())
+	}
+}
+
+// loadFile applies a YAML or TOML config file, chosen by its extension
+func (cfg *Config) loadFile(path string, settings []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CONFIG_FILE: %v", err)
+	}
+
+	sections := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &sections)
+	case ".toml":
+		err = toml.Unmarshal(data, &sections)
+	default:
+		return fmt.Errorf("CONFIG_FILE %s must be a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	byKey := make(map[string]*setting)
+	for i := range settings {
+		byKey[settings[i].key] = &settings[i]
+	}
+
+	var errs []error
+	for _, section := range sortedKeys(sections) {
+		entries, ok := sections[section].(map[string]interface{})
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s must be a section of settings", path, section))
+			continue
+		}
+		for _, name := range sortedKeys(entries) {
+			value := entries[name]
+			s, ok := byKey[section+"."+name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %s.%s", path, section, name))
+				continue
+			}
+			cfg.sources[s.env] = path
+			text := fileValue(value)
+			if err := s.set(text); err != nil {
+				errs = append(errs, fmt.Errorf("%s=%s (%s): %v", s.key, text, path, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedKeys returns the keys of a config file section in order, so errors are reported consistently
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fileValue formats a value of a config file the way an environment variable holds it
+func fileValue(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// redactURL hides the password of a database URL
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+	return parsed.Redacted()
+}
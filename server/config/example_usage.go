@@ -1,25 +0,0 @@
-package config
-
-// Example of how to use the Cloudflare Zero Trust configuration in your main application
-/*
-import (
-	"resort-app-server/config"
-	
-	"github.com/gin-gonic/gin"
-)
-
-func main() {
-	// Create Cloudflare Zero Trust configuration
-	cfConfig := config.NewCloudflareZeroTrustConfig()
-	
-	// Create Gin router
-	router := gin.Default()
-	
-	// Add Cloudflare Zero Trust validation middleware
-	router.Use(cfConfig.ValidateCloudflareAccessJWT())
-	
-	// ... rest of your application routes
-	
-	router.Run(":8080")
-}
-*/
\ No newline at end of file
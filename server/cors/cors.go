@@ -0,0 +1,151 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAllowedHeaders are the request headers browsers may send on cross-origin requests
+var DefaultAllowedHeaders = []string{"Content-Type", "Authorization", "Cf-Access-Jwt-Assertion", "If-Match", "If-None-Match", "Idempotency-Key"}
+
+// DefaultExposedHeaders are the response headers browsers let cross-origin scripts read
+var DefaultExposedHeaders = []string{"ETag", "Location", "Idempotent-Replayed"}
+
+// DefaultAllowedMethods are the methods browsers may use on cross-origin requests
+var DefaultAllowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// Config is the cross-origin policy of the server
+type Config struct {
+	// AllowedOrigins are origins such as https://example.com. A * in place of the
+	// first host label, https://*.example.com, matches every subdomain of example.com.
+	AllowedOrigins []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	AllowedMethods []string
+	MaxAge         int // seconds browsers may cache a preflight
+}
+
+// ParseOrigins reads a comma-separated list of allowed origins and checks each one
+func ParseOrigins(value string) ([]string, error) {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" {
+			return nil, fmt.Errorf("%q is not an origin such as https://example.com", origin)
+		}
+		if strings.Contains(strings.TrimPrefix(parsed.Host, "*."), "*") {
+			return nil, fmt.Errorf("%q may only use * as its first host label, as in https://*.example.com", origin)
+		}
+		origins = append(origins, strings.ToLower(origin))
+	}
+	return origins, nil
+}
+
+// ParseHeaders reads a comma-separated list of header names
+func ParseHeaders(value string) []string {
+	var headers []string
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return headers
+}
+
+// IsOriginAllowed reports whether a request Origin matches one of the allowed origins
+func (cfg *Config) IsOriginAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range cfg.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+
+		// https://*.example.com matches https://a.example.com and https://a.b.example.com
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if ok && strings.HasPrefix(origin, scheme+"://") {
+			requestHost := strings.TrimPrefix(origin, scheme+"://")
+			if strings.HasSuffix(requestHost, "."+host) && len(requestHost) > len(host)+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware returns a Gin middleware that applies the policy. Only allowed origins are
+// echoed in Access-Control-Allow-Origin; preflights from other origins, or asking for
+// methods and headers outside the policy, are answered with 403.
+func Middleware(cfg *Config) gin.HandlerFunc {
+	allowedMethods := make(map[string]bool)
+	for _, method := range cfg.AllowedMethods {
+		allowedMethods[strings.ToUpper(method)] = true
+	}
+	allowedHeaders := make(map[string]bool)
+	for _, header := range cfg.AllowedHeaders {
+		allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return func(c *gin.Context) {
+		// The response depends on the Origin, so caches must keep one copy per origin
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// Same-origin and non-browser requests carry no Origin
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !cfg.IsOriginAllowed(origin) {
+			if preflight {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Origin %s is not allowed", origin)})
+				return
+			}
+			// Browsers refuse to expose the response without the allow header
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+
+		if !preflight {
+			if len(cfg.ExposedHeaders) > 0 {
+				c.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+
+		method := strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))
+		if !allowedMethods[method] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Method %s is not allowed", method)})
+			return
+		}
+		for _, header := range ParseHeaders(c.GetHeader("Access-Control-Request-Headers")) {
+			if !allowedHeaders[header] {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Header %s is not allowed", header)})
+				return
+			}
+		}
+
+		c.Header("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+		c.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+		c.Header("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
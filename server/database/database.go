@@ -2,73 +2,189 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
-	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+// Drivers supported by Open
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
 
-// InitDB initializes the SQLite database
-func InitDB() {
-	// Load environment variables
-	err := godotenv.Load("../.env")
-	if err != nil {
-		// Try to load from current directory as fallback
-		err = godotenv.Load(".env")
+// Database is an open SQL database together with the driver it uses
+type Database struct {
+	*sql.DB
+	Driver string
+}
+
+// IsMemoryURL reports whether a DATABASE_URL selects the in-memory stores instead of a database
+func IsMemoryURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, "memory:")
+}
+
+// InitDB opens the database and checks its schema. Pending migrations are applied
+// when migrate is true, otherwise the server refuses to start instead.
+func InitDB(databaseURL, dbPath string, migrate bool) *Database {
+	db := Open(databaseURL, dbPath)
+
+	if err := db.CheckSchema(migrate); err != nil {
+		log.Fatal("Database schema check failed: ", err)
+	}
+
+	return db
+}
+
+// Open connects to the database selected by databaseURL without touching its schema.
+// A postgres:// URL selects Postgres; sqlite:<path>, or an empty URL, selects SQLite at
+// that path, dbPath or data/resort.db.
+func Open(databaseURL, dbPath string) *Database {
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		db, err := sql.Open(Postgres, databaseURL)
+		if err == nil {
+			err = db.Ping()
+		}
 		if err != nil {
-			log.Println("No .env file found, using default settings")
+			log.Fatal("Failed to open database:", err)
+		}
+		return &Database{DB: db, Driver: Postgres}
+
+	case databaseURL == "" || strings.HasPrefix(databaseURL, "sqlite:"):
+		if path := strings.TrimPrefix(strings.TrimPrefix(databaseURL, "sqlite://"), "sqlite:"); path != "" {
+			dbPath = path
 		}
+		return openSQLite(dbPath)
+
+	default:
+		log.Fatalf("Unsupported DATABASE_URL %q, use postgres://, sqlite: or memory:", databaseURL)
+		return nil
 	}
+}
 
+// openSQLite opens the SQLite database at dbPath or data/resort.db
+func openSQLite(dbPath string) *Database {
 	// Create data directory if it doesn't exist
 	dataDir := "data"
 	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
 		os.Mkdir(dataDir, 0755)
 	}
 
-	// Get database path from environment variable or use default
-	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = filepath.Join(dataDir, "resort.db")
 	}
 
-	// Open database connection
-	DB, err = sql.Open("sqlite3", dbPath)
+	// Open database connection. Transactions take the write lock when they begin, so
+	// the overlap check and the write of a booking cannot interleave with another one.
+	db, err := sql.Open(SQLite, dbPath+"?_txlock=immediate&_busy_timeout=5000&_foreign_keys=1")
 	if err != nil {
 		log.Fatal("Failed to open database:", err)
 	}
 
-	// Create tables
-	createTables()
+	return &Database{DB: db, Driver: SQLite}
+}
+
+// Rebind rewrites the ? placeholders of a query for the driver, Postgres numbers them $1, $2, ...
+func (db *Database) Rebind(query string) string {
+	if db.Driver != Postgres {
+		return query
+	}
+
+	var rebound strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		rebound.WriteRune(r)
+	}
+	return rebound.String()
+}
+
+// adoptLegacySchema brings a SQLite database created before versioned migrations up to
+// the schema of the first migration, which then only creates what is still missing.
+// Older servers created the tables themselves and added new columns one at a time.
+func (db *Database) adoptLegacySchema() error {
+	columns := []struct{ table, column, definition string }{
+		// The houses table used to hold only the names of the houses in data/houses.json
+		{"houses", "description", "TEXT NOT NULL DEFAULT ''"},
+		{"houses", "location", "TEXT NOT NULL DEFAULT ''"},
+		{"houses", "rating", "REAL NOT NULL DEFAULT 0"},
+		{"houses", "price_per_night", "REAL NOT NULL DEFAULT 0"},
+		{"houses", "image_url", "TEXT NOT NULL DEFAULT ''"},
+		{"houses", "guests", "INTEGER NOT NULL DEFAULT 0"},
+		// Bookings made before they were linked to houses, backfilled by repository.BackfillBookingHouses
+		{"bookings", "house_id", "INTEGER REFERENCES houses(id)"},
+		// Timestamps of the booking status lifecycle
+		{"bookings", "checked_in_at", "TIMESTAMP"},
+		{"bookings", "checked_out_at", "TIMESTAMP"},
+		{"bookings", "cancelled_at", "TIMESTAMP"},
+		{"bookings", "customer_name", "TEXT"},
+		{"bookings", "phone_number", "TEXT"},
+		// Conversations created before the booking dialogue state existed
+		{"conversations", "booking_state", "TEXT"},
+	}
+
+	for _, c := range columns {
+		exists, err := db.tableExists(c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err := db.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	bookings, err := db.tableExists("bookings")
+	if err != nil || !bookings {
+		return err
+	}
+
+	// Chat bookings used to be saved without a check-out date, they were single-night stays
+	_, err = db.Exec("UPDATE bookings SET check_out = date(check_in, '+1 day') WHERE check_out = ''")
+	return err
+}
+
+// tableExists reports whether the database has a table
+func (db *Database) tableExists(table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if db.Driver == Postgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	}
+
+	var count int
+	err := db.QueryRow(query, table).Scan(&count)
+	return count > 0, err
 }
 
-// createTables creates the necessary tables if they don't exist
-func createTables() {
-	// Create bookings table with payment status
-	bookingsTable := `
-	CREATE TABLE IF NOT EXISTS bookings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		resort_name TEXT NOT NULL,
-		check_in DATE NOT NULL,
-		check_out DATE NOT NULL,
-		guests INTEGER NOT NULL,
-		total_price REAL NOT NULL,
-		status TEXT NOT NULL DEFAULT 'pending', -- pending, confirmed, paid, cancelled
-		payment_date DATE,
-		customer_name TEXT,
-		phone_number TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	_, err := DB.Exec(bookingsTable)
+// addColumnIfMissing adds a column to a table created by an older version of the server
+func (db *Database) addColumnIfMissing(table, column, definition string) error {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
 	if err != nil {
-		log.Fatal("Failed to create bookings table:", err)
+		return fmt.Errorf("failed to add %s.%s column: %v", table, column, err)
 	}
 
-	log.Println("Database tables created successfully")
+	log.Printf("Added %s column to %s table", column, table)
+	return nil
 }
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration scripts are named <version>_<name>.up.sql and <version>_<name>.down.sql, in
+// one directory per driver. Both directories have the same versions.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// migrationDirs maps each driver to the directory of its migration scripts
+var migrationDirs = map[string]string{
+	SQLite:   "migrations/sqlite",
+	Postgres: "migrations/postgres",
+}
+
+// Migration is a versioned schema change with the scripts that apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied to the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt string // empty while the migration is pending
+}
+
+// Migrations returns the migrations embedded in the server for the driver, ordered by version
+func (db *Database) Migrations() ([]Migration, error) {
+	dir := migrationDirs[db.Driver]
+	paths, err := fs.Glob(migrationFiles, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, path := range paths {
+		file := strings.TrimPrefix(path, dir+"/")
+
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", file)
+		}
+
+		prefix, name, found := strings.Cut(strings.TrimSuffix(file, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", file)
+		}
+
+		script, err := migrationFiles.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has scripts named %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// CheckSchema compares the database with the embedded migrations. Pending migrations
+// are applied when apply is true and reported as an error otherwise. A database
+// migrated by a newer server is always an error.
+func (db *Database) CheckSchema(apply bool) error {
+	statuses, err := db.Status()
+	if err != nil {
+		return err
+	}
+
+	var pending []MigrationStatus
+	for _, status := range statuses {
+		if status.Name == "" {
+			return fmt.Errorf("database has migration %d, which this server does not know; upgrade the server", status.Version)
+		}
+		if status.AppliedAt == "" {
+			pending = append(pending, status)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if !apply {
+		return fmt.Errorf("database has %d pending migrations, run the server with `migrate up` first", len(pending))
+	}
+
+	_, err = db.MigrateUp()
+	return err
+}
+
+// Status returns every embedded migration and whether it was applied, followed by the
+// migrations the database has but this server does not know, which have no name
+func (db *Database) Status() ([]MigrationStatus, error) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	known := make(map[int]bool)
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, AppliedAt: applied[migration.Version]})
+	}
+
+	var unknown []int
+	for version := range applied {
+		if !known[version] {
+			unknown = append(unknown, version)
+		}
+	}
+	sort.Ints(unknown)
+	for _, version := range unknown {
+		statuses = append(statuses, MigrationStatus{Version: version, AppliedAt: applied[version]})
+	}
+
+	return statuses, nil
+}
+
+// MigrateUp applies the pending migrations in order and returns them
+func (db *Database) MigrateUp() ([]Migration, error) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := db.runMigration(migration, migration.Up, true); err != nil {
+			return done, err
+		}
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and returns them
+func (db *Database) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Migration)
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var versions []int
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	var done []Migration
+	for _, version := range versions {
+		if len(done) == steps {
+			break
+		}
+		migration, known := byVersion[version]
+		if !known {
+			return done, fmt.Errorf("cannot revert migration %d, this server does not know it", version)
+		}
+		if err := db.runMigration(migration, migration.Down, false); err != nil {
+			return done, err
+		}
+		log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// runMigration runs a script and records the result in schema_migrations, in one transaction
+func (db *Database) runMigration(migration Migration, script string, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(db.Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), migration.Version, migration.Name)
+	} else {
+		_, err = tx.Exec(db.Rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureMigrationsTable creates the schema_migrations table. A SQLite database created
+// before it existed is adopted first.
+func (db *Database) ensureMigrationsTable() error {
+	exists, err := db.tableExists("schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+
+	if db.Driver == SQLite {
+		if err := db.adoptLegacySchema(); err != nil {
+			return fmt.Errorf("failed to adopt the existing schema: %v", err)
+		}
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`)
+	return err
+}
+
+// appliedMigrations returns when each applied migration was applied, by version
+func (db *Database) appliedMigrations() (map[int]string, error) {
+	applied := make(map[int]string)
+	exists, err := db.tableExists("schema_migrations")
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt.Format(time.RFC3339)
+	}
+
+	return applied, rows.Err()
+}
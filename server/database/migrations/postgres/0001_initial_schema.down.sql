@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_messages_conversation_id;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversations;
+DROP INDEX IF EXISTS idx_bookings_house_id;
+DROP TABLE IF EXISTS bookings;
+DROP TABLE IF EXISTS house_amenities;
+DROP TABLE IF EXISTS houses;
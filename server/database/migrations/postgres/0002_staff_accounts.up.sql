@@ -0,0 +1,11 @@
+-- Staff accounts that sign in to manage bookings, see the auth package for the roles
+CREATE TABLE staff (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	username TEXT NOT NULL,
+	password_hash TEXT NOT NULL, -- bcrypt
+	role TEXT NOT NULL, -- admin, receptionist, read_only
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Usernames are unique regardless of case, like COLLATE NOCASE on SQLite
+CREATE UNIQUE INDEX idx_staff_username ON staff (lower(username));
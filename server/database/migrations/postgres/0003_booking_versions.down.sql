@@ -0,0 +1,2 @@
+ALTER TABLE bookings DROP COLUMN updated_at;
+ALTER TABLE bookings DROP COLUMN version;
@@ -0,0 +1,5 @@
+-- Every write of a booking increments its version, which is its ETag, so concurrent
+-- edits can be detected with If-Match
+ALTER TABLE bookings ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE bookings ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+UPDATE bookings SET updated_at = created_at;
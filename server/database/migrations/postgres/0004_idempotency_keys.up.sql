@@ -0,0 +1,12 @@
+-- Outcomes of requests that must not be repeated, so a retry with the same key returns
+-- the first outcome: REST requests with an Idempotency-Key header and chat bookings
+CREATE TABLE idempotency_keys (
+	idempotency_key TEXT PRIMARY KEY,
+	request_hash TEXT NOT NULL, -- SHA-256 of the request, a reused key must repeat the same request
+	status_code INTEGER NOT NULL DEFAULT 0, -- 0 while the first request is in progress
+	response TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,2 @@
+-- The numbers stay in E.164 form, their original formatting was not kept
+SELECT 1;
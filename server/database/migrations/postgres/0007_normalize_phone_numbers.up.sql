@@ -0,0 +1,19 @@
+-- Phone numbers are stored in E.164 form, such as +628123456789, by the rules of
+-- phone_number.Normalize: formatting is removed, numbers without a country code are
+-- Indonesian. Numbers that do not give a possible phone number are left as they are.
+CREATE TEMP TABLE normalized_phone_numbers ON COMMIT DROP AS
+SELECT id, regexp_replace(phone_number, '[[:space:]().-]', '', 'g') AS phone
+FROM bookings WHERE phone_number IS NOT NULL AND phone_number != '';
+
+UPDATE normalized_phone_numbers SET phone = '+' || substr(phone, 3) WHERE phone LIKE '00%';
+UPDATE normalized_phone_numbers SET phone = '+62' || substr(phone, 2) WHERE phone LIKE '0%';
+UPDATE normalized_phone_numbers SET phone = '+' || phone WHERE phone NOT LIKE '+%' AND phone LIKE '62%';
+UPDATE normalized_phone_numbers SET phone = '+62' || phone WHERE phone NOT LIKE '+%';
+-- The trunk prefix is often kept after the country code, as in +62 (0)812
+UPDATE normalized_phone_numbers SET phone = '+62' || substr(phone, 5) WHERE phone LIKE '+620%';
+
+UPDATE bookings SET phone_number = normalized_phone_numbers.phone
+FROM normalized_phone_numbers
+WHERE normalized_phone_numbers.id = bookings.id
+  AND normalized_phone_numbers.phone ~ '^\+[1-9][0-9]{7,14}$'
+  AND (normalized_phone_numbers.phone NOT LIKE '+62%' OR normalized_phone_numbers.phone ~ '^\+62[0-9]{8,12}$');
@@ -0,0 +1,2 @@
+-- Headers of the stored response, such as the ETag, replayed together with it as a JSON object
+ALTER TABLE idempotency_keys ADD COLUMN response_headers TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,63 @@
+-- Schema of the server before versioned migrations. Databases created by older
+-- versions already have these tables, so every statement is idempotent.
+
+-- House catalog, seeded from data/houses.json by repository.SeedHouses
+CREATE TABLE IF NOT EXISTS houses (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	description TEXT NOT NULL DEFAULT '',
+	location TEXT NOT NULL DEFAULT '',
+	rating REAL NOT NULL DEFAULT 0,
+	price_per_night REAL NOT NULL DEFAULT 0,
+	image_url TEXT NOT NULL DEFAULT '',
+	guests INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS house_amenities (
+	house_id INTEGER NOT NULL REFERENCES houses(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL, -- order in which the amenities are listed
+	amenity TEXT NOT NULL,
+	PRIMARY KEY (house_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS bookings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	house_id INTEGER REFERENCES houses(id),
+	resort_name TEXT NOT NULL, -- name of the house when the booking was made
+	check_in DATE NOT NULL,
+	check_out DATE NOT NULL,
+	guests INTEGER NOT NULL,
+	total_price REAL NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending', -- pending, confirmed, paid, checked_in, checked_out, cancelled, no_show
+	payment_date DATE,
+	checked_in_at TIMESTAMP,
+	checked_out_at TIMESTAMP,
+	cancelled_at TIMESTAMP,
+	customer_name TEXT,
+	phone_number TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookings_house_id ON bookings(house_id, check_in);
+
+-- Chat sessions, the server keeps the whole conversation history
+CREATE TABLE IF NOT EXISTS conversations (
+	id TEXT PRIMARY KEY,
+	booking_state TEXT, -- JSON encoded state of the booking dialogue
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	role TEXT NOT NULL, -- user, assistant, tool
+	content TEXT NOT NULL DEFAULT '',
+	name TEXT,
+	tool_calls TEXT, -- JSON encoded tool calls of an assistant turn
+	tool_call_id TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id, id);
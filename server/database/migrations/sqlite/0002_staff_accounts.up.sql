@@ -0,0 +1,8 @@
+-- Staff accounts that sign in to manage bookings, see the auth package for the roles
+CREATE TABLE staff (
+	id INTEGER PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	password_hash TEXT NOT NULL, -- bcrypt
+	role TEXT NOT NULL, -- admin, receptionist, read_only
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX idx_bookings_reference;
+ALTER TABLE bookings DROP COLUMN reference;
@@ -0,0 +1,4 @@
+-- Guests look up their booking by its reference code, such as BLI-7XK2QF. Codes are
+-- generated by the server, bookings made before this migration get one on startup.
+ALTER TABLE bookings ADD COLUMN reference TEXT;
+CREATE UNIQUE INDEX idx_bookings_reference ON bookings(reference);
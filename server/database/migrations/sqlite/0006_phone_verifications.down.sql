@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_phone_verifications_expires_at;
+DROP TABLE IF EXISTS phone_verifications;
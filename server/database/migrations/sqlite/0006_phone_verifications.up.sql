@@ -0,0 +1,13 @@
+-- One-time codes that verify a phone number, one per scope: the booking of a chat
+-- conversation or a guest looking up a booking
+CREATE TABLE phone_verifications (
+	scope TEXT PRIMARY KEY,
+	phone_number TEXT NOT NULL,
+	code_hash TEXT NOT NULL, -- SHA-256 of the scope and the code
+	attempts INTEGER NOT NULL DEFAULT 0, -- wrong codes entered
+	sent_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	verified_at TIMESTAMP
+);
+
+CREATE INDEX idx_phone_verifications_expires_at ON phone_verifications(expires_at);
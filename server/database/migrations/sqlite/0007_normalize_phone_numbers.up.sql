@@ -0,0 +1,22 @@
+-- Phone numbers are stored in E.164 form, such as +628123456789, by the rules of
+-- phone_number.Normalize: formatting is removed, numbers without a country code are
+-- Indonesian. Numbers that do not give a possible phone number are left as they are.
+CREATE TEMP TABLE normalized_phone_numbers AS
+SELECT id, REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(TRIM(phone_number), ' ', ''), char(9), ''), char(10), ''), char(13), ''), '-', ''), '.', ''), '(', ''), ')', '') AS phone
+FROM bookings WHERE phone_number IS NOT NULL AND phone_number != '';
+
+UPDATE normalized_phone_numbers SET phone = '+' || substr(phone, 3) WHERE phone LIKE '00%';
+UPDATE normalized_phone_numbers SET phone = '+62' || substr(phone, 2) WHERE phone LIKE '0%';
+UPDATE normalized_phone_numbers SET phone = '+' || phone WHERE phone NOT LIKE '+%' AND phone LIKE '62%';
+UPDATE normalized_phone_numbers SET phone = '+62' || phone WHERE phone NOT LIKE '+%';
+-- The trunk prefix is often kept after the country code, as in +62 (0)812
+UPDATE normalized_phone_numbers SET phone = '+62' || substr(phone, 5) WHERE phone LIKE '+620%';
+
+UPDATE bookings SET phone_number = (SELECT phone FROM normalized_phone_numbers WHERE normalized_phone_numbers.id = bookings.id)
+WHERE id IN (
+    SELECT id FROM normalized_phone_numbers
+    WHERE phone GLOB '+[1-9]*' AND substr(phone, 2) NOT GLOB '*[^0-9]*' AND length(phone) BETWEEN 9 AND 16
+      AND (phone NOT LIKE '+62%' OR length(phone) BETWEEN 11 AND 15)
+);
+
+DROP TABLE normalized_phone_numbers;
@@ -0,0 +1,329 @@
+package date_resolver
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // The resort timezone must resolve even on hosts without zoneinfo
+)
+
+// DefaultTimezone is the timezone of the resort in Bali
+const DefaultTimezone = "Asia/Makassar"
+
+// DateLayout is the format used for booking dates
+const DateLayout = "2006-01-02"
+
+// Result is a date found in a message
+type Result struct {
+	Date       time.Time
+	Expression string // The part of the message the date was resolved from
+}
+
+// String returns the date in YYYY-MM-DD format
+func (r *Result) String() string {
+	return r.Date.Format(DateLayout)
+}
+
+// location is the resort timezone, see SetLocation
+var location, _ = time.LoadLocation(DefaultTimezone)
+
+// SetLocation sets the resort timezone, DefaultTimezone until it is called
+func SetLocation(l *time.Location) {
+	location = l
+}
+
+// Location returns the resort timezone
+func Location() *time.Location {
+	return location
+}
+
+// Today returns the current date in the resort timezone
+func Today() time.Time {
+	return dateOf(time.Now().In(Location()))
+}
+
+// rule resolves the expressions matched by pattern against the reference date
+type rule struct {
+	pattern *regexp.Regexp
+	resolve func(match []string, today time.Time) (time.Time, bool)
+}
+
+// Resolve finds the first date expression in text, in Indonesian or English, and
+// resolves it against reference in the resort timezone.
+// Relative expressions ("besok", "lusa", "senin depan", "in 3 days") and absolute
+// ones ("15/12", "December 15th", "15 Desember 2026") are supported.
+func Resolve(text string, reference time.Time) (*Result, bool) {
+	today := dateOf(reference.In(Location()))
+	normalized := strings.ToLower(text)
+
+	for _, r := range rules {
+		match := r.pattern.FindStringSubmatch(normalized)
+		if match == nil {
+			continue
+		}
+
+		date, ok := r.resolve(match, today)
+		if !ok {
+			continue
+		}
+
+		return &Result{Date: date, Expression: strings.TrimSpace(match[0])}, true
+	}
+
+	return nil, false
+}
+
+// dateOf truncates a time to midnight of its day, keeping the location
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+var weekdays = map[string]time.Weekday{
+	"minggu": time.Sunday, "ahad": time.Sunday, "sunday": time.Sunday, "sun": time.Sunday,
+	"senin": time.Monday, "monday": time.Monday, "mon": time.Monday,
+	"selasa": time.Tuesday, "tuesday": time.Tuesday, "tue": time.Tuesday,
+	"rabu": time.Wednesday, "wednesday": time.Wednesday, "wed": time.Wednesday,
+	"kamis": time.Thursday, "thursday": time.Thursday, "thu": time.Thursday,
+	"jumat": time.Friday, "jum'at": time.Friday, "friday": time.Friday, "fri": time.Friday,
+	"sabtu": time.Saturday, "saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"januari": time.January, "january": time.January, "jan": time.January,
+	"februari": time.February, "february": time.February, "feb": time.February, "pebruari": time.February,
+	"maret": time.March, "march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"mei": time.May, "may": time.May,
+	"juni": time.June, "june": time.June, "jun": time.June,
+	"juli": time.July, "july": time.July, "jul": time.July,
+	"agustus": time.August, "august": time.August, "agu": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"oktober": time.October, "october": time.October, "okt": time.October, "oct": time.October,
+	"november": time.November, "nopember": time.November, "nov": time.November,
+	"desember": time.December, "december": time.December, "des": time.December, "dec": time.December,
+}
+
+var numberWords = map[string]int{
+	"satu": 1, "se": 1, "dua": 2, "tiga": 3, "empat": 4, "lima": 5, "enam": 6,
+	"tujuh": 7, "delapan": 8, "sembilan": 9, "sepuluh": 10,
+	"one": 1, "a": 1, "an": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// alternation builds a regexp alternation of the keys of a map, longest first
+func alternation[V any](words map[string]V) string {
+	keys := make([]string, 0, len(words))
+	for key := range words {
+		keys = append(keys, regexp.QuoteMeta(key))
+	}
+	// Longer words first so "september" wins over "sep"
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && len(keys[j]) > len(keys[j-1]); j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return "(" + strings.Join(keys, "|") + ")"
+}
+
+var (
+	weekdayPattern = alternation(weekdays)
+	monthPattern   = alternation(months)
+	numberPattern  = `(\d{1,3}|` + strings.TrimPrefix(alternation(numberWords), "(")
+)
+
+// parseNumber converts digits or a number word
+func parseNumber(value string) (int, bool) {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n, true
+	}
+	n, ok := numberWords[value]
+	return n, ok
+}
+
+// offset returns a rule for a fixed number of days after today
+func offset(pattern string, days int) rule {
+	return rule{
+		pattern: regexp.MustCompile(pattern),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			return today.AddDate(0, 0, days), true
+		},
+	}
+}
+
+// nextWeekday returns the first day with the given weekday on or after from
+func nextWeekday(from time.Time, weekday time.Weekday) time.Time {
+	return from.AddDate(0, 0, (int(weekday)-int(from.Weekday())+7)%7)
+}
+
+// startOfNextWeek returns the Monday of the week after today
+func startOfNextWeek(today time.Time) time.Time {
+	return nextWeekday(today.AddDate(0, 0, 1), time.Monday)
+}
+
+// weekendOf returns the Saturday of the weekend on or after today, or today when it is already the weekend
+func weekendOf(today time.Time) time.Time {
+	if today.Weekday() == time.Sunday {
+		return today
+	}
+	return nextWeekday(today, time.Saturday)
+}
+
+// dateFromParts builds a date, picking the next occurrence when no year is given
+func dateFromParts(day int, month time.Month, year string, today time.Time) (time.Time, bool) {
+	y := today.Year()
+	if year != "" {
+		parsed, err := strconv.Atoi(year)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if parsed < 100 {
+			parsed += 2000
+		}
+		y = parsed
+	}
+
+	if month < time.January || month > time.December || day < 1 {
+		return time.Time{}, false
+	}
+
+	date := time.Date(y, month, day, 0, 0, 0, 0, today.Location())
+	if date.Day() != day {
+		// e.g. 31/11 rolled over into the next month
+		return time.Time{}, false
+	}
+
+	if year == "" && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, true
+}
+
+// rules are tried in order, more specific expressions first
+var rules = []rule{
+	// ISO dates: 2026-12-15
+	{
+		pattern: regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			month, _ := strconv.Atoi(match[2])
+			day, _ := strconv.Atoi(match[3])
+			return dateFromParts(day, time.Month(month), match[1], today)
+		},
+	},
+	// Day first numeric dates: 15/12, 15/12/2026
+	{
+		pattern: regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})(?:/(\d{4}|\d{2}))?\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			day, _ := strconv.Atoi(match[1])
+			month, _ := strconv.Atoi(match[2])
+			return dateFromParts(day, time.Month(month), match[3], today)
+		},
+	},
+	// With dashes or dots the year is required, "2-3 orang" is not a date: 15-12-26, 15.12.2026
+	{
+		pattern: regexp.MustCompile(`\b(\d{1,2})([.-])(\d{1,2})([.-])(\d{4}|\d{2})\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			if match[2] != match[4] {
+				return time.Time{}, false
+			}
+			day, _ := strconv.Atoi(match[1])
+			month, _ := strconv.Atoi(match[3])
+			return dateFromParts(day, time.Month(month), match[5], today)
+		},
+	},
+	// Day before month name: 15 December, 15 Desember 2026, 15th of December
+	{
+		pattern: regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?` + monthPattern + `\b\.?(?:,?\s+(\d{4}))?`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			day, _ := strconv.Atoi(match[1])
+			return dateFromParts(day, months[match[2]], match[3], today)
+		},
+	},
+	// Month name before day: December 15th, Dec 15, 2026
+	{
+		pattern: regexp.MustCompile(`\b` + monthPattern + `\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+(\d{4}))?`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			day, _ := strconv.Atoi(match[2])
+			return dateFromParts(day, months[match[1]], match[3], today)
+		},
+	},
+
+	// "besok lusa" is used for the day after tomorrow as well
+	offset(`\b(besok lusa|lusa|day after tomorrow)\b`, 2),
+	offset(`\b(besok|esok|tomorrow)\b`, 1),
+	offset(`\b(hari ini|malam ini|today|tonight)\b`, 0),
+
+	// In N days: lima hari lagi, 3 hari lagi, dalam 3 hari, in 3 days, 3 days from now, seminggu lagi
+	{
+		pattern: regexp.MustCompile(`\b(?:dalam\s+|in\s+)?` + numberPattern + `\s*(hari|minggu|pekan|bulan|days?|weeks?|months?)\s*(lagi|kemudian|dari sekarang|from now|later)?\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			// Without "dalam"/"in" or a trailing word it is a duration, not a date
+			if !strings.HasPrefix(match[0], "dalam") && !strings.HasPrefix(match[0], "in") && match[3] == "" {
+				return time.Time{}, false
+			}
+			n, ok := parseNumber(match[1])
+			if !ok {
+				return time.Time{}, false
+			}
+			switch match[2] {
+			case "hari", "day", "days":
+				return today.AddDate(0, 0, n), true
+			case "minggu", "pekan", "week", "weeks":
+				return today.AddDate(0, 0, 7*n), true
+			default:
+				return today.AddDate(0, n, 0), true
+			}
+		},
+	},
+	{
+		pattern: regexp.MustCompile(`\b(bulan depan|next month)\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			return today.AddDate(0, 1, 0), true
+		},
+	},
+
+	// Weekends: akhir pekan depan, next weekend, akhir pekan, this weekend
+	{
+		pattern: regexp.MustCompile(`\b(akhir (?:pekan|minggu) depan|next weekend)\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			return nextWeekday(startOfNextWeek(today), time.Saturday), true
+		},
+	},
+	{
+		pattern: regexp.MustCompile(`\b(akhir (?:pekan|minggu)(?: ini)?|(?:this )?weekend)\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			return weekendOf(today), true
+		},
+	},
+
+	// Weekdays of next week: hari minggu depan, senin depan, next monday.
+	// "minggu depan" alone means next week, so Sunday needs the "hari" prefix.
+	{
+		pattern: regexp.MustCompile(`\bhari\s+` + weekdayPattern + `\s+depan\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			return nextWeekday(startOfNextWeek(today), weekdays[match[1]]), true
+		},
+	},
+	offset(`\b(minggu depan|pekan depan|next week)\b`, 7),
+	{
+		pattern: regexp.MustCompile(`\b` + weekdayPattern + `\s+depan\b|\bnext\s+` + weekdayPattern + `\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			name := match[1]
+			if name == "" {
+				name = match[2]
+			}
+			return nextWeekday(startOfNextWeek(today), weekdays[name]), true
+		},
+	},
+	// Upcoming weekdays: hari jumat, jumat ini, this friday, on friday
+	{
+		pattern: regexp.MustCompile(`\b(?:hari|this|on)\s+` + weekdayPattern + `\b|\b` + weekdayPattern + `\s+ini\b`),
+		resolve: func(match []string, today time.Time) (time.Time, bool) {
+			name := match[1]
+			if name == "" {
+				name = match[2]
+			}
+			return nextWeekday(today, weekdays[name]), true
+		},
+	},
+}
@@ -1,22 +1,31 @@
 package main
 
 import (
-	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"resort-app-server/booking_lifecycle"
+	"resort-app-server/merge_patch"
 	"resort-app-server/models"
+	"resort-app-server/phone_number"
+	"resort-app-server/pricing"
 	"resort-app-server/repository"
-	"resort-app-server/tool_calling/function_calling"
 
 	"github.com/gin-gonic/gin"
-	openai "github.com/sashabaranov/go-openai"
 )
 
+// bookingHandler serves the booking endpoints on the injected stores
+type bookingHandler struct {
+	stores *repository.Stores
+}
+
 // getBookings returns all bookings
-func getBookings(c *gin.Context) {
-	bookings, err := repository.GetAllBookings()
+func (h *bookingHandler) getBookings(c *gin.Context) {
+	bookings, err := h.stores.Bookings.GetAllBookings()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
 		return
@@ -29,14 +38,14 @@ func getBookings(c *gin.Context) {
 }
 
 // getBooking returns a specific booking by ID
-func getBooking(c *gin.Context) {
+func (h *bookingHandler) getBooking(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
 		return
 	}
 
-	booking, err := repository.GetBookingByID(id)
+	booking, err := h.stores.Bookings.GetBookingByID(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking"})
 		return
@@ -47,19 +56,59 @@ func getBooking(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", bookingETag(booking))
+	if c.GetHeader("If-None-Match") == bookingETag(booking) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, booking)
 }
 
+// bookingETag is the entity tag of a booking, it changes with every update
+func bookingETag(booking *models.Booking) string {
+	return fmt.Sprintf(`"booking-%d-v%d"`, booking.ID, booking.Version)
+}
+
+// checkIfMatch enforces the If-Match header of a write to booking. Without the header the
+// write is refused when required is true, so clients cannot overwrite changes they have
+// not seen. It writes the error response and returns false when the write must not happen.
+func checkIfMatch(c *gin.Context, booking *models.Booking, required bool) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if !required {
+			return true
+		}
+		c.Header("ETag", bookingETag(booking))
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the ETag of the booking is required"})
+		return false
+	}
+
+	etag := bookingETag(booking)
+	for _, candidate := range strings.Split(header, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	c.Header("ETag", etag)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "Booking has been changed since it was read",
+		"version": booking.Version,
+	})
+	return false
+}
+
 // createBooking creates a new booking
-func createBooking(c *gin.Context) {
+func (h *bookingHandler) createBooking(c *gin.Context) {
 	var bookingInput struct {
-		UserID     int     `json:"user_id" binding:"required"`
-		ResortName string  `json:"resort_name" binding:"required"`
-		CheckIn    string  `json:"check_in" binding:"required"`
-		CheckOut   string  `json:"check_out" binding:"required"`
-		Guests     int     `json:"guests" binding:"required"`
-		TotalPrice float64 `json:"total_price" binding:"required"`
-		Status     string  `json:"status"`
+		UserID     int    `json:"user_id" binding:"required"`
+		HouseID    int    `json:"house_id"`
+		ResortName string `json:"resort_name"`
+		CheckIn    string `json:"check_in" binding:"required"`
+		CheckOut   string `json:"check_out" binding:"required"`
+		Guests     int    `json:"guests" binding:"required"`
+		Status     string `json:"status"`
 	}
 
 	if err := c.BindJSON(&bookingInput); err != nil {
@@ -67,489 +116,427 @@ func createBooking(c *gin.Context) {
 		return
 	}
 
-	// Set default status if not provided
+	// Set default status if not provided, later statuses are reached through the action endpoints
 	if bookingInput.Status == "" {
-		bookingInput.Status = "pending"
+		bookingInput.Status = booking_lifecycle.StatusPending
+	}
+	if bookingInput.Status != booking_lifecycle.StatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New bookings start as pending"})
+		return
 	}
 
 	booking := &models.Booking{
 		UserID:     bookingInput.UserID,
+		HouseID:    bookingInput.HouseID,
 		ResortName: bookingInput.ResortName,
 		CheckIn:    bookingInput.CheckIn,
 		CheckOut:   bookingInput.CheckOut,
 		Guests:     bookingInput.Guests,
-		TotalPrice: bookingInput.TotalPrice,
 		Status:     bookingInput.Status,
 	}
 
-	err := repository.CreateBooking(booking)
+	if !h.priceBooking(c, booking) {
+		return
+	}
+
+	err := h.stores.Bookings.CreateBooking(booking)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create booking"})
+		writeBookingSaveError(c, err, "Failed to create booking")
 		return
 	}
 
+	c.Header("ETag", bookingETag(booking))
+	c.Header("Location", "/api/bookings/"+strconv.Itoa(booking.ID))
 	c.JSON(http.StatusCreated, booking)
 }
 
-// updateBooking updates an existing booking
-func updateBooking(c *gin.Context) {
+// priceBooking links the booking to its house, given by house_id or by name, and sets the
+// total price from the house rate and the stay length; a total sent by the client is never
+// trusted. It writes the error response and returns false on failure.
+func (h *bookingHandler) priceBooking(c *gin.Context, booking *models.Booking) bool {
+	var house *models.House
+	var err error
+	switch {
+	case booking.HouseID != 0:
+		house, err = h.stores.Houses.GetHouseByID(booking.HouseID)
+	case booking.ResortName != "":
+		house, err = h.stores.Houses.GetHouseByName(booking.ResortName)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "house_id or resort_name is required"})
+		return false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve house"})
+		return false
+	}
+
+	if house == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown house"})
+		return false
+	}
+
+	if booking.Guests > house.Guests {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s accommodates at most %d guests", house.Name, house.Guests)})
+		return false
+	}
+
+	quote, err := pricing.QuoteStay(house, booking.CheckIn, booking.CheckOut)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	booking.HouseID = house.ID
+	booking.ResortName = house.Name
+	booking.CheckOut = quote.CheckOut
+	booking.TotalPrice = quote.TotalPrice
+	return true
+}
+
+// bookingInput holds the fields of a booking that clients may change. It is the body of
+// PUT and the document a PATCH is applied to.
+type bookingInput struct {
+	UserID       int    `json:"user_id"`
+	HouseID      int    `json:"house_id"`
+	ResortName   string `json:"resort_name"`
+	CheckIn      string `json:"check_in"`
+	CheckOut     string `json:"check_out"`
+	Guests       int    `json:"guests"`
+	Status       string `json:"status"`
+	CustomerName string `json:"customer_name"`
+	PhoneNumber  string `json:"phone_number"`
+}
+
+// loadBookingForUpdate loads the booking of the :id parameter and checks the If-Match
+// header against it. It writes the error response and returns nil on failure.
+func (h *bookingHandler) loadBookingForUpdate(c *gin.Context) *models.Booking {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
-		return
+		return nil
 	}
 
 	// Check if booking exists
-	existingBooking, err := repository.GetBookingByID(id)
+	existingBooking, err := h.stores.Bookings.GetBookingByID(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking"})
-		return
+		return nil
 	}
 
 	if existingBooking == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
-		return
+		return nil
 	}
 
-	var bookingInput struct {
-		UserID      int     `json:"user_id"`
-		ResortName  string  `json:"resort_name"`
-		CheckIn     string  `json:"check_in"`
-		CheckOut    string  `json:"check_out"`
-		Guests      int     `json:"guests"`
-		TotalPrice  float64 `json:"total_price"`
-		Status      string  `json:"status"`
-		PaymentDate string  `json:"payment_date"`
+	if !checkIfMatch(c, existingBooking, true) {
+		return nil
 	}
+	return existingBooking
+}
 
-	if err := c.BindJSON(&bookingInput); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+// updateBooking replaces the changeable fields of a booking, fields left out of the body
+// are cleared. The If-Match header must carry the ETag of the booking.
+func (h *bookingHandler) updateBooking(c *gin.Context) {
+	existingBooking := h.loadBookingForUpdate(c)
+	if existingBooking == nil {
 		return
 	}
 
-	// Update the booking with new values
-	updatedBooking := &models.Booking{
-		ID:          id,
-		UserID:      bookingInput.UserID,
-		ResortName:  bookingInput.ResortName,
-		CheckIn:     bookingInput.CheckIn,
-		CheckOut:    bookingInput.CheckOut,
-		Guests:      bookingInput.Guests,
-		TotalPrice:  bookingInput.TotalPrice,
-		Status:      bookingInput.Status,
-		PaymentDate: bookingInput.PaymentDate,
-		CreatedAt:   existingBooking.CreatedAt,
+	var input bookingInput
+	if err := c.BindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
 	}
 
-	err = repository.UpdateBooking(updatedBooking)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
+	h.saveBookingInput(c, existingBooking, input)
+}
+
+// patchBooking applies a JSON Merge Patch (RFC 7396) to the changeable fields of a
+// booking: fields left out keep their value and null clears them. The If-Match header
+// must carry the ETag of the booking.
+func (h *bookingHandler) patchBooking(c *gin.Context) {
+	if contentType := c.ContentType(); contentType != merge_patch.ContentType && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + merge_patch.ContentType})
 		return
 	}
 
-	c.JSON(http.StatusOK, updatedBooking)
-}
+	existingBooking := h.loadBookingForUpdate(c)
+	if existingBooking == nil {
+		return
+	}
 
-// deleteBooking removes a booking
-func deleteBooking(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	patch, err := c.GetRawData()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	// Check if booking exists
-	booking, err := repository.GetBookingByID(id)
+	current := bookingInput{
+		UserID:       existingBooking.UserID,
+		HouseID:      existingBooking.HouseID,
+		ResortName:   existingBooking.ResortName,
+		CheckIn:      existingBooking.CheckIn,
+		CheckOut:     existingBooking.CheckOut,
+		Guests:       existingBooking.Guests,
+		Status:       existingBooking.Status,
+		CustomerName: existingBooking.CustomerName,
+		PhoneNumber:  existingBooking.PhoneNumber,
+	}
+	document, err := json.Marshal(current)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to patch booking"})
 		return
 	}
 
-	if booking == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+	// Only the fields of bookingInput can be patched, the price and lifecycle timestamps follow from them
+	keys, err := merge_patch.Keys(patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(document, &fields); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to patch booking"})
+		return
+	}
+	patched := make(map[string]bool)
+	for _, key := range keys {
+		if _, ok := fields[key]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Field %s cannot be changed", key)})
+			return
+		}
+		patched[key] = true
+	}
 
-	err = repository.DeleteBooking(id)
+	result, err := merge_patch.Apply(document, patch)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete booking"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge patch: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Booking deleted successfully"})
-}
-
-// getBookingsByStatus returns bookings filtered by status
-func getBookingsByStatus(c *gin.Context) {
-	status := c.Param("status")
-	if status == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Status parameter is required"})
+	var input bookingInput
+	if err := json.Unmarshal(result, &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge patch: " + err.Error()})
 		return
 	}
 
-	bookings, err := repository.GetBookingsByStatus(status)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
-		return
+	// A new house name without a house ID moves the booking to the house with that name
+	if patched["resort_name"] && !patched["house_id"] && input.ResortName != current.ResortName {
+		input.HouseID = 0
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"bookings": bookings,
-		"count":    len(bookings),
-		"status":   status,
-	})
+	h.saveBookingInput(c, existingBooking, input)
 }
 
-// getBookingsByUser returns bookings for a specific user
-func getBookingsByUser(c *gin.Context) {
-	userID, err := strconv.Atoi(c.Param("user_id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+// saveBookingInput applies the changeable fields to a copy of existingBooking, prices the
+// stay again when it changed and saves it. The lifecycle fields are kept.
+func (h *bookingHandler) saveBookingInput(c *gin.Context, existingBooking *models.Booking, input bookingInput) {
+	if input.Guests < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "guests must be at least 1"})
 		return
 	}
 
-	bookings, err := repository.GetBookingsByUserID(userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
-		return
+	updatedBooking := *existingBooking
+	updatedBooking.UserID = input.UserID
+	updatedBooking.HouseID = input.HouseID
+	updatedBooking.ResortName = input.ResortName
+	updatedBooking.CheckIn = input.CheckIn
+	updatedBooking.CheckOut = input.CheckOut
+	updatedBooking.Guests = input.Guests
+	updatedBooking.CustomerName = input.CustomerName
+	updatedBooking.PhoneNumber = input.PhoneNumber
+
+	// A status change has to be a legal transition
+	if input.Status != "" && input.Status != existingBooking.Status {
+		if !transitionBooking(c, &updatedBooking, input.Status) {
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"bookings": bookings,
-		"count":    len(bookings),
-		"user_id":  userID,
-	})
-}
+	// The price is only computed again when the stay changes, a booking keeps the rate
+	// it was made at
+	if stayChanged(existingBooking, &updatedBooking) && !h.priceBooking(c, &updatedBooking) {
+		return
+	}
 
-// ChatMessage represents a message in the chat
-type ChatMessage struct {
-	Role      string `json:"role"`
-	Content   string `json:"content"`
-	Timestamp string `json:"timestamp,omitempty"`
-}
+	err := h.stores.Bookings.UpdateBooking(&updatedBooking)
+	if err != nil {
+		writeBookingSaveError(c, err, "Failed to update booking")
+		return
+	}
 
-// ChatRequest represents the request structure for the chat endpoint
-type ChatRequest struct {
-	Messages []ChatMessage `json:"messages"`
+	c.Header("ETag", bookingETag(&updatedBooking))
+	c.JSON(http.StatusOK, updatedBooking)
 }
 
-// ChatResponse represents the response structure for the chat endpoint
-type ChatResponse struct {
-	Message string `json:"message"`
+// stayChanged reports whether the house, the dates or the guest count of a booking differ
+func stayChanged(existing, updated *models.Booking) bool {
+	return updated.HouseID != existing.HouseID || updated.ResortName != existing.ResortName ||
+		updated.CheckIn != existing.CheckIn || updated.CheckOut != existing.CheckOut || updated.Guests != existing.Guests
 }
 
-// chatWithAI handles the AI chat functionality
-func chatWithAI(c *gin.Context) {
-	var req ChatRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+// writeBookingSaveError writes the response for a booking that could not be saved.
+// A booking that overlaps another one for the same house is a conflict, and so is a
+// booking changed by another request since it was read, which fails the If-Match
+// precondition when the client sent one. An impossible phone number is a bad request.
+func writeBookingSaveError(c *gin.Context, err error, message string) {
+	if invalidPhone, ok := err.(*phone_number.InvalidError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidPhone.Error()})
 		return
 	}
-
-	// Get OpenAI API key from environment
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "OpenAI API key not configured"})
+	if err == repository.ErrBookingVersionConflict {
+		status := http.StatusConflict
+		if c.GetHeader("If-Match") != "" {
+			status = http.StatusPreconditionFailed
+		}
+		c.JSON(status, gin.H{"error": "Booking has been changed since it was read"})
 		return
 	}
+	if conflict, ok := err.(*repository.BookingConflictError); ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":               conflict.Error(),
+			"conflicting_booking": conflict.ConflictingID,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
 
-	// Create OpenAI client with custom configuration
-	config := openai.DefaultConfig(apiKey)
-
-	// Check if a custom base URL is set in environment
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if baseURL != "" {
-		config.BaseURL = baseURL
+// transitionBooking moves a booking to a new status. It writes the error response
+// and returns false when the lifecycle does not allow the change.
+func transitionBooking(c *gin.Context, booking *models.Booking, status string) bool {
+	if err := booking_lifecycle.Transition(booking, status, time.Now()); err != nil {
+		if transitionErr, ok := err.(*booking_lifecycle.TransitionError); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":               transitionErr.Error(),
+				"status":              transitionErr.From,
+				"allowed_transitions": transitionErr.Allowed,
+			})
+			return false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
 	}
+	return true
+}
+
+// bookingAction returns a handler that moves a booking to status, e.g. POST /api/bookings/:id/confirm
+func (h *bookingHandler) bookingAction(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
+			return
+		}
 
-	client := openai.NewClientWithConfig(config)
+		booking, err := h.stores.Bookings.GetBookingByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking"})
+			return
+		}
 
-	// Convert messages to OpenAI format
-	openaiMessages := make([]openai.ChatCompletionMessage, len(req.Messages))
-	for i, msg := range req.Messages {
-		content := msg.Content
-		// If timestamp is provided, prepend it to the content
-		if msg.Timestamp != "" {
-			content = "time:" + msg.Timestamp + "\n" + content
+		if booking == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+			return
 		}
 
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: content,
+		if !checkIfMatch(c, booking, false) || !transitionBooking(c, booking, status) {
+			return
 		}
-	}
 
-	var systemPrompt = `You are a Resort Bot, a helpful AI assistant designed to help customers book accommodations at a resort. You must follow a specific conversation flow to collect booking information step by step.
-
-CURRENT TIME CONTEXT:
-- You will receive current time information in the format "time: DD-MM-YYYY" at the beginning of user messages
-- Use this as your reference point for calculating relative dates
-- Always acknowledge and confirm the actual date when user mentions relative time
-
-CONVERSATION FLOW:
-You must follow this exact sequence of questions and only move to the next step after receiving a valid response:
-
-Step 1: Check-in Date
-- Ask: "When do you want to stay?"
-- Wait for user to provide a date
-- Accept dates in ANY format including:
-  * Absolute dates: "15 December", "15/12/2024", "December 15th"
-  * Relative dates: "besok" (tomorrow), "lusa" (day after tomorrow), "minggu depan" (next week), "lima hari lagi" (5 days from now), "senin depan" (next Monday), "akhir pekan" (weekend), etc.
-- When user gives relative dates, calculate the actual date based on the provided current time
-- Always confirm the calculated date: "I understand you want to book for [actual date] ([relative term]). Is that correct?"
-- Move to Step 2 only after date confirmation
-
-Step 2: Number of Guests
-- Ask: "How many people?"
-- Wait for user to specify number of guests
-- Accept numeric responses (1, 2, 3, etc. or "one person", "two people", etc.)
-- Move to Step 3
-
-Step 3: House Type Selection
-- Use function calling to dynamically fetch houses based on guest count from Step 2
-- When you need to retrieve houses, output the guest count in <HOUSE_LIST_DATA> tags to trigger the house retrieval function
-- Example format:
-  <HOUSE_LIST_DATA>
-  {
-    "guests": 2
-  }
-  </HOUSE_LIST_DATA>
-
-- Wait for user to select one option
-- Move to Step 4
-
-Step 4: Booking Summary
-- Display a summary using JSON format with the following structure:
-  <[BOOKING_SUMMARY]>
-  {
-    "date": "[confirmed actual date]",
-    "guests": [number],
-    "houseType": "[selected house type]"
-  }
-  </[BOOKING_SUMMARY]>
-- The system will automatically display a formal booking summary based on this JSON data
-- Ask user to "Confirm" or "Cancel"
-- If Cancel: restart from Step 1
-- If Confirm: move to Step 5
-
-Step 5: Contact Information
-- Say: "Got it. Just a couple more details. What's your full name and phone number?"
-- Wait for user to provide both name and phone number
-- Accept in any reasonable format
-- Move to Step 6
-
-Step 6: Final Confirmation & Booking Data Output
-- When all details are collected and confirmed, output the booking data in this EXACT format inside <BOOKING_DATA> tags:
-  
-  <BOOKING_DATA>
-  {
-    "resort_name": "[selected house type]",
-    "check_in": "[date in YYYY-MM-DD format]",
-    "check_out": "",
-    "guests": [number],
-    "total_price": 0,
-    "customer_name": "[customer name]",
-    "phone_number": "[phone number]"
-  }
-  </BOOKING_DATA>
-  
-- After outputting the booking data, say: "Thank you! Your booking is now pending confirmation from our receptionist. We'll contact you shortly about the payment."
-- End the booking process
-
-IMPORTANT RULES:
-1. Sequential Flow: Never skip steps or ask multiple questions at once
-2. One Question at a Time: Wait for user response before moving to next step
-3. Validation: Ensure each step is completed before proceeding
-4. Friendly Tone: Keep responses conversational and helpful
-5. Error Handling: If user provides unclear input, politely ask for clarification
-6. No Deviation: Don't discuss other topics until booking is complete
-7. TIME INTELLIGENCE: You have natural language understanding for time - use it to interpret Indonesian relative time expressions intelligently
-8. DATE CONFIRMATION: Always confirm relative dates by stating the actual calculated date
-9. STRUCTURED OUTPUT: When booking is complete, ALWAYS output booking data in the specified <BOOKING_DATA> format
-
-RESPONSE STYLE:
-- Keep messages concise and clear
-- Use friendly, professional language
-- Always identify yourself as "Resort Bot" when greeting
-- Use natural conversation flow while maintaining the structure
-- Show your calculation when processing relative dates
-
-EXAMPLE INTERACTIONS:
-
-User: "time: 05-12-2026 besok lusa saya order"
-Bot: "I understand you want to book for December 7, 2026 (lusa - day after tomorrow). Is that correct?"
-
-User: "time: 15-11-2026 minggu depan saya mau booking"  
-Bot: "I understand you want to book for November 22, 2026 (minggu depan - next week). Is that correct?"
-
-User: "time: 10-01-2026 lima hari lagi"
-Bot: "I understand you want to book for January 15, 2026 (lima hari lagi - 5 days from now). Is that correct?"
-
-User: "15 December"
-Bot: "When do you want to stay?"
-
-User: "besok"
-Bot: "I understand you want to book for [actual date] (besok - tomorrow). Is that correct?"
-
-User: "lusa"
-Bot: "I understand you want to book for [actual date] (lusa - day after tomorrow). Is that correct?"
-
-User: "minggu depan"
-Bot: "I understand you want to book for [actual date] (minggu depan - next week). Is that correct?"
-
-User: "lima hari lagi"
-Bot: "I understand you want to book for [actual date] (lima hari lagi - 5 days from now). Is that correct?"
-
-User: "senin depan"
-Bot: "I understand you want to book for [actual date] (senin depan - next Monday). Is that correct?"
-
-User: "akhir pekan"
-Bot: "I understand you want to book for [actual date] (akhir pekan - weekend). Is that correct?"
-
-User: "2 people"
-Bot: "Which houses are available?
-[The system will automatically display all houses that can accommodate 2 guests:
-
-HOUSE LIST FUNCTION CALLING:
-When you need to retrieve houses based on the number of guests, output the data in this EXACT format inside <HOUSE_LIST_DATA> tags:
-  
-  <HOUSE_LIST_DATA>
-  {
-    "guests": [number of guests]
-  }
-  </HOUSE_LIST_DATA>
-
-BOOKING DATA OUTPUT EXAMPLE:
-When booking is complete, output exactly like this:
-
-<BOOKING_DATA>
-{
-  "resort_name": "Pool Villa",
-  "check_in": "2026-12-07",
-  "check_out": "",
-  "guests": 2,
-  "total_price": 0,
-  "customer_name": "Jane Doe",
-  "phone_number": "+1234567890"
+		if err := h.stores.Bookings.UpdateBooking(booking); err != nil {
+			writeBookingSaveError(c, err, "Failed to update booking")
+			return
+		}
+
+		c.Header("ETag", bookingETag(booking))
+		c.JSON(http.StatusOK, booking)
+	}
 }
-</BOOKING_DATA>
-
-Thank you! Your booking is now pending confirmation from our receptionist. We'll contact you shortly about the payment.
-
-ERROR RESPONSES:
-- If user asks unrelated questions during booking: "Let's complete your booking first. [repeat current question]"
-- If user provides invalid input: "I need [specific information]. Could you please provide that?"
-- If relative date is unclear: "Could you clarify the date? When you say '[user's term]', I want to make sure I understand correctly."
-`
-	// Add system message to provide context about the resort booking assistant
-	systemMessage := openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleSystem,
-		Content: systemPrompt,
-	}
-
-	// Prepend system message to the messages array
-	openaiMessages = append([]openai.ChatCompletionMessage{systemMessage}, openaiMessages...)
-
-	// Get model from environment, with fallback to GPT-3.5 Turbo
-	model := os.Getenv("OPENAI_MODEL")
-	if model == "" {
-		model = openai.GPT3Dot5Turbo
-	}
-
-	// Get additional parameters from environment variables with defaults
-	temperature := parseFloatEnv(os.Getenv("OPENAI_TEMPERATURE"), 0.1)
-	topP := parseFloatEnv(os.Getenv("OPENAI_TOP_P"), 0.3)
-	maxTokens := parseIntEnv(os.Getenv("OPENAI_MAX_TOKENS"), 0) // 0 means no limit
-	presencePenalty := parseFloatEnv(os.Getenv("OPENAI_PRESENCE_PENALTY"), 0.1)
-	frequencyPenalty := parseFloatEnv(os.Getenv("OPENAI_FREQUENCY_PENALTY"), 0.3)
-
-	// Create chat completion request
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:            model,
-			Messages:         openaiMessages,
-			Temperature:      temperature,
-			TopP:             topP,
-			MaxTokens:        maxTokens,
-			PresencePenalty:  presencePenalty,
-			FrequencyPenalty: frequencyPenalty,
-		},
-	)
 
+// deleteBooking removes a booking
+func (h *bookingHandler) deleteBooking(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get response from AI", "details": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking ID"})
 		return
 	}
 
-	// Check if this is a function calling response
-	aiMessage := resp.Choices[0].Message.Content
-	if function_calling.IsFunctionCallingExecuted(aiMessage) {
-		// Process the function calling
-		response, found, err := function_calling.ProcessFunctionCalling(aiMessage)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+	// Check if booking exists
+	booking, err := h.stores.Bookings.GetBookingByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking"})
+		return
+	}
 
-		if found {
-			// Check the type of response and return appropriately
-			if responseMap, ok := response.(map[string]interface{}); ok {
-				// If it's a house options response, return it as JSON
-				if responseType, exists := responseMap["type"]; exists && responseType == "house_options" {
-					c.JSON(http.StatusOK, responseMap)
-					return
-				}
-				// For other responses, return as ChatResponse
-				if message, exists := responseMap["message"]; exists {
-					c.JSON(http.StatusOK, ChatResponse{
-						Message: message.(string),
-					})
-					return
-				}
-			}
-			// Default response format
-			c.JSON(http.StatusOK, response)
-			return
-		}
+	if booking == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
 	}
 
-	// Return the AI response
-	c.JSON(http.StatusOK, ChatResponse{
-		Message: aiMessage,
-	})
+	if !checkIfMatch(c, booking, false) {
+		return
+	}
+
+	err = h.stores.Bookings.DeleteBooking(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete booking"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Booking deleted successfully"})
 }
 
-// parseFloatEnv converts string environment variable to float32 with a default value
-func parseFloatEnv(env string, defaultValue float32) float32 {
-	if env == "" {
-		return defaultValue
+// getBookingsByStatus returns bookings filtered by status
+func (h *bookingHandler) getBookingsByStatus(c *gin.Context) {
+	status := c.Param("status")
+	if status == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status parameter is required"})
+		return
+	}
+
+	if !booking_lifecycle.IsValidStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
 	}
 
-	value, err := strconv.ParseFloat(env, 32)
+	bookings, err := h.stores.Bookings.GetBookingsByStatus(status)
 	if err != nil {
-		return defaultValue
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
 	}
 
-	return float32(value)
+	c.JSON(http.StatusOK, gin.H{
+		"bookings": bookings,
+		"count":    len(bookings),
+		"status":   status,
+	})
 }
 
-// parseIntEnv converts string environment variable to int with a default value
-func parseIntEnv(env string, defaultValue int) int {
-	if env == "" {
-		return defaultValue
+// getBookingsByUser returns bookings for a specific user
+func (h *bookingHandler) getBookingsByUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
 	}
 
-	value, err := strconv.Atoi(env)
+	bookings, err := h.stores.Bookings.GetBookingsByUserID(userID)
 	if err != nil {
-		return defaultValue
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
 	}
 
-	return value
+	c.JSON(http.StatusOK, gin.H{
+		"bookings": bookings,
+		"count":    len(bookings),
+		"user_id":  userID,
+	})
 }
 
 // getBookingsByCustomerInfo retrieves bookings by customer name and phone number
-func getBookingsByCustomerInfo(c *gin.Context) {
+func (h *bookingHandler) getBookingsByCustomerInfo(c *gin.Context) {
 	name := c.Query("name")
 	phone := c.Query("phone")
 
@@ -558,7 +545,7 @@ func getBookingsByCustomerInfo(c *gin.Context) {
 		return
 	}
 
-	bookings, err := repository.GetBookingsByCustomerInfo(name, phone)
+	bookings, err := h.stores.Bookings.GetBookingsByCustomerInfo(name, phone)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
 		return
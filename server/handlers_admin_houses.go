@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"resort-app-server/models"
+	"resort-app-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// houseInput is the request body of the admin house endpoints
+type houseInput struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Location      string   `json:"location"`
+	Rating        float64  `json:"rating"`
+	PricePerNight float64  `json:"price_per_night"`
+	ImageURL      string   `json:"image_url"`
+	Amenities     []string `json:"amenities"`
+	Guests        int      `json:"guests"`
+}
+
+// toHouse validates the input and converts it to a house
+func (input *houseInput) toHouse() (*models.House, error) {
+	house := &models.House{
+		Name:          strings.TrimSpace(input.Name),
+		Description:   strings.TrimSpace(input.Description),
+		Location:      strings.TrimSpace(input.Location),
+		Rating:        input.Rating,
+		PricePerNight: input.PricePerNight,
+		ImageURL:      strings.TrimSpace(input.ImageURL),
+		Amenities:     []string{},
+		Guests:        input.Guests,
+	}
+
+	if house.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if house.PricePerNight <= 0 {
+		return nil, errors.New("price_per_night must be greater than 0")
+	}
+	if house.Guests <= 0 {
+		return nil, errors.New("guests must be greater than 0")
+	}
+	if house.Rating < 0 || house.Rating > 5 {
+		return nil, errors.New("rating must be between 0 and 5")
+	}
+	if house.ImageURL != "" {
+		imageURL, err := url.Parse(house.ImageURL)
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+			return nil, errors.New("image_url must be an http or https URL")
+		}
+	}
+
+	for _, amenity := range input.Amenities {
+		amenity = strings.TrimSpace(amenity)
+		if amenity == "" {
+			return nil, errors.New("amenities must not be empty")
+		}
+		house.Amenities = append(house.Amenities, amenity)
+	}
+
+	return house, nil
+}
+
+// bindHouse reads and validates the house in the request body. It writes the error
+// response and returns nil on failure.
+func bindHouse(c *gin.Context) *models.House {
+	var input houseInput
+	if err := c.BindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return nil
+	}
+
+	house, err := input.toHouse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	return house
+}
+
+// checkHouseNameFree rejects a name used by another house, names identify houses in the chat.
+// It writes the error response and returns false on failure.
+func (h *houseHandler) checkHouseNameFree(c *gin.Context, house *models.House) bool {
+	existing, err := h.stores.Houses.GetHouseByName(house.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve house"})
+		return false
+	}
+
+	if existing != nil && existing.ID != house.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A house named %s already exists", existing.Name)})
+		return false
+	}
+	return true
+}
+
+// createHouse adds a house to the catalog
+func (h *houseHandler) createHouse(c *gin.Context) {
+	house := bindHouse(c)
+	if house == nil || !h.checkHouseNameFree(c, house) {
+		return
+	}
+
+	if err := h.stores.Houses.CreateHouse(house); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create house"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, house)
+}
+
+// updateHouse replaces the details of a house
+func (h *houseHandler) updateHouse(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid house ID"})
+		return
+	}
+
+	existingHouse, err := h.stores.Houses.GetHouseByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve house"})
+		return
+	}
+
+	if existingHouse == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "House not found"})
+		return
+	}
+
+	house := bindHouse(c)
+	if house == nil {
+		return
+	}
+	house.ID = id
+	if !h.checkHouseNameFree(c, house) {
+		return
+	}
+
+	if err := h.stores.Houses.UpdateHouse(house); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update house"})
+		return
+	}
+
+	c.JSON(http.StatusOK, house)
+}
+
+// deleteHouse removes a house that has never been booked
+func (h *houseHandler) deleteHouse(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid house ID"})
+		return
+	}
+
+	house, err := h.stores.Houses.GetHouseByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve house"})
+		return
+	}
+
+	if house == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "House not found"})
+		return
+	}
+
+	err = h.stores.Houses.DeleteHouse(id)
+	if errors.Is(err, repository.ErrHouseHasBookings) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s has bookings and cannot be deleted", house.Name)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete house"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "House deleted successfully"})
+}
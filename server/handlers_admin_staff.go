@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"resort-app-server/auth"
+	"resort-app-server/models"
+	"resort-app-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staffHandler serves the admin endpoints of the staff accounts
+type staffHandler struct {
+	stores *repository.Stores
+}
+
+// staffInput is the request body of the admin staff endpoints. On update, empty fields
+// keep their current value.
+type staffInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// apply validates the input and writes it to staff. It writes the error response and
+// returns false on failure.
+func (h *staffHandler) apply(c *gin.Context, input *staffInput, staff *models.Staff) bool {
+	if username := strings.TrimSpace(input.Username); username != "" {
+		existing, err := h.stores.Staff.GetStaffByUsername(username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve staff account"})
+			return false
+		}
+		if existing != nil && existing.ID != staff.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The username %s is taken", existing.Username)})
+			return false
+		}
+		staff.Username = username
+	}
+
+	if input.Role != "" {
+		if !auth.IsValidRole(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(auth.Roles, ", ")})
+			return false
+		}
+		staff.Role = input.Role
+	}
+
+	if input.Password != "" {
+		if err := auth.ValidatePassword(input.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		hash, err := auth.HashPassword(input.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return false
+		}
+		staff.PasswordHash = hash
+	}
+
+	return true
+}
+
+// getStaff returns all staff accounts
+func (h *staffHandler) getStaff(c *gin.Context) {
+	accounts, err := h.stores.Staff.GetAllStaff()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve staff accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"staff": accounts,
+		"count": len(accounts),
+	})
+}
+
+// createStaff adds a staff account
+func (h *staffHandler) createStaff(c *gin.Context) {
+	var input staffInput
+	if err := c.BindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if strings.TrimSpace(input.Username) == "" || input.Password == "" || input.Role == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username, password and role are required"})
+		return
+	}
+
+	staff := &models.Staff{}
+	if !h.apply(c, &input, staff) {
+		return
+	}
+
+	if err := h.stores.Staff.CreateStaff(staff); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create staff account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, staff)
+}
+
+// updateStaff changes the username, password or role of a staff account
+func (h *staffHandler) updateStaff(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		return
+	}
+
+	staff, err := h.stores.Staff.GetStaffByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve staff account"})
+		return
+	}
+
+	if staff == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff account not found"})
+		return
+	}
+
+	var input staffInput
+	if err := c.BindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always an admin left
+	if input.Role != "" && input.Role != staff.Role && staff.ID == auth.GetIdentity(c).StaffID {
+		c.JSON(http.StatusConflict, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+
+	if !h.apply(c, &input, staff) {
+		return
+	}
+
+	if err := h.stores.Staff.UpdateStaff(staff); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update staff account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, staff)
+}
+
+// deleteStaff removes a staff account
+func (h *staffHandler) deleteStaff(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		return
+	}
+
+	staff, err := h.stores.Staff.GetStaffByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve staff account"})
+		return
+	}
+
+	if staff == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff account not found"})
+		return
+	}
+
+	if staff.ID == auth.GetIdentity(c).StaffID {
+		c.JSON(http.StatusConflict, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	if err := h.stores.Staff.DeleteStaff(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete staff account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff account deleted successfully"})
+}
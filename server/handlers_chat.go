@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"resort-app-server/booking_flow"
+	"resort-app-server/llm"
+	"resort-app-server/models"
+	"resort-app-server/repository"
+	"resort-app-server/tool_calling/function_calling"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxToolRounds limits how many times the model may call tools before giving a final answer
+const maxToolRounds = 5
+
+// ChatRequest represents the request structure for the chat endpoint.
+// Only the new user turn is sent, the server rebuilds the history from storage.
+type ChatRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+	Message   string `json:"message" binding:"required"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+const systemPrompt = `You are a Resort Bot, a helpful AI assistant designed to help customers book accommodations at a resort. You must follow a specific conversation flow to collect booking information step by step.
+
+CURRENT TIME CONTEXT:
+- You will receive current time information in the format "time: DD-MM-YYYY" at the beginning of user messages
+- Use this as your reference point for calculating relative dates
+- Always acknowledge and confirm the actual date when user mentions relative time
+
+CONVERSATION FLOW:
+You must follow this exact sequence of questions and only move to the next step after receiving a valid response:
+
+Step 1: Check-in Date
+- Ask: "When do you want to stay?"
+- Wait for user to provide a date
+- Accept dates in ANY format including:
+  * Absolute dates: "15 December", "15/12/2024", "December 15th"
+  * Relative dates: "besok" (tomorrow), "lusa" (day after tomorrow), "minggu depan" (next week), "lima hari lagi" (5 days from now), "senin depan" (next Monday), "akhir pekan" (weekend), etc.
+- When user gives relative dates, calculate the actual date based on the provided current time
+- Always confirm the calculated date: "I understand you want to book for [actual date] ([relative term]). Is that correct?"
+- Once the user confirms, call update_booking_details with the check_in date in YYYY-MM-DD format
+- Move to Step 2 only after date confirmation
+
+Step 2: Length of Stay
+- Ask: "How many nights will you stay?"
+- Accept a number of nights ("3 nights", "tiga malam") or a check-out date
+- Call update_booking_details with nights, or with check_out in YYYY-MM-DD format when the user gives a date
+- The check-out date must be after the check-in date
+- Move to Step 3
+
+Step 3: Number of Guests
+- Ask: "How many people?"
+- Wait for user to specify number of guests
+- Accept numeric responses (1, 2, 3, etc. or "one person", "two people", etc.)
+- Move to Step 4
+
+Step 4: House Type Selection
+- Call the get_houses tool with the guest count from Step 3, this also records the guest count
+- Only houses that are free for the whole stay are listed
+- The houses are shown to the user as selectable cards, so do not repeat the whole list
+- Wait for user to select one option
+- Call update_booking_details with the selected house_name, its result contains the price quote for the stay
+- Move to Step 5
+
+Step 5: Booking Summary
+- Display a summary using JSON format with the following structure:
+  <[BOOKING_SUMMARY]>
+  {
+    "date": "[confirmed actual date]",
+    "checkOut": "[check-out date]",
+    "nights": [number of nights],
+    "guests": [number],
+    "houseType": "[selected house type]",
+    "totalPrice": [total_price from the quote]
+  }
+  </[BOOKING_SUMMARY]>
+- The system will automatically display a formal booking summary based on this JSON data
+- Ask user to "Confirm" or "Cancel"
+- If Cancel: call update_booking_details with restart set to true and restart from Step 1
+- If Confirm: call update_booking_details with summary_confirmed set to true and move to Step 6
+
+Step 6: Contact Information
+- Say: "Got it. Just a couple more details. What's your full name and phone number?"
+- Wait for user to provide both name and phone number
+- Accept in any reasonable format
+- Call update_booking_details with the customer_name and phone_number
+- If the result says a verification code was sent, ask the user for the code and call verify_phone with it. If the code is wrong, expired or did not arrive, follow the tool result; call verify_phone with resend set to true when the user needs a new code
+- Move to Step 7 once the phone number is verified
+
+Step 7: Final Confirmation & Saving the Booking
+- When all details are collected and confirmed, call the save_booking tool with the house name, the check-in and check-out dates in YYYY-MM-DD format, the number of guests, the customer name and the phone number
+- If the tool reports an error, explain the problem to the user and ask for the missing or invalid information
+- After the booking is saved, say: "Thank you! Your booking is now pending confirmation from our receptionist. Your booking reference is [reference from the save_booking result], please keep it to check your booking. We'll contact you shortly about the payment."
+- End the booking process
+
+IMPORTANT RULES:
+1. Sequential Flow: Never skip steps or ask multiple questions at once
+2. One Question at a Time: Wait for user response before moving to next step
+3. Validation: Ensure each step is completed before proceeding
+4. Friendly Tone: Keep responses conversational and helpful
+5. Error Handling: If user provides unclear input, politely ask for clarification
+6. No Deviation: Don't discuss other topics until booking is complete
+7. TIME INTELLIGENCE: You have natural language understanding for time - use it to interpret Indonesian relative time expressions intelligently
+8. DATE CONFIRMATION: Always confirm relative dates by stating the actual calculated date. The server resolves the user's date expression as well, if a tool result contains a note correcting check_in, use the corrected date
+9. TOOLS: Only use the provided tools to look up houses and save bookings, never print raw tool arguments in your reply
+10. BOOKING STATE: Each turn ends with a BOOKING STATE message from the system listing the current step and the missing slots. Follow it, the server rejects details and bookings given out of order
+
+RESPONSE STYLE:
+- Keep messages concise and clear
+- Use friendly, professional language
+- Always identify yourself as "Resort Bot" when greeting
+- Use natural conversation flow while maintaining the structure
+- Show your calculation when processing relative dates
+
+EXAMPLE INTERACTIONS:
+
+User: "time: 05-12-2026 besok lusa saya order"
+Bot: "I understand you want to book for December 7, 2026 (lusa - day after tomorrow). Is that correct?"
+
+User: "time: 15-11-2026 minggu depan saya mau booking"
+Bot: "I understand you want to book for November 22, 2026 (minggu depan - next week). Is that correct?"
+
+User: "time: 10-01-2026 lima hari lagi"
+Bot: "I understand you want to book for January 15, 2026 (lima hari lagi - 5 days from now). Is that correct?"
+
+User: "senin depan"
+Bot: "I understand you want to book for [actual date] (senin depan - next Monday). Is that correct?"
+
+User: "akhir pekan"
+Bot: "I understand you want to book for [actual date] (akhir pekan - weekend). Is that correct?"
+
+User: "2 people"
+Bot: [calls get_houses with {"guests": 2}] "Here are the houses available for 2 guests. Which one would you like?"
+
+ERROR RESPONSES:
+- If user asks unrelated questions during booking: "Let's complete your booking first. [repeat current question]"
+- If user provides invalid input: "I need [specific information]. Could you please provide that?"
+- If relative date is unclear: "Could you clarify the date? When you say '[user's term]', I want to make sure I understand correctly."
+`
+
+// createChatSession starts a new server-side chat session
+func (h *chatHandler) createChatSession(c *gin.Context) {
+	conversation, err := h.stores.Conversations.CreateConversation()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat session"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"session_id": conversation.ID,
+		"created_at": conversation.CreatedAt,
+	})
+}
+
+// getChatSessions returns all chat sessions
+func (h *chatHandler) getChatSessions(c *gin.Context) {
+	conversations, err := h.stores.Conversations.GetAllConversations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": conversations,
+		"count":    len(conversations),
+	})
+}
+
+// getChatSession returns a chat session with its full message history
+func (h *chatHandler) getChatSession(c *gin.Context) {
+	conversation, err := h.stores.Conversations.GetConversationByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat session"})
+		return
+	}
+
+	if conversation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return
+	}
+
+	messages, err := h.stores.Conversations.GetConversationMessages(conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat messages"})
+		return
+	}
+
+	state, err := booking_flow.Load(conversation.BookingState)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking state"})
+		return
+	}
+
+	// The booking summary tags the model wrote are internal to the server
+	for i := range messages {
+		if messages[i].Role == openai.ChatMessageRoleAssistant {
+			messages[i].Content = stripSummaryTags(messages[i].Content)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session":       conversation,
+		"booking_state": state.Summary(),
+		"messages":      messages,
+	})
+}
+
+// chatHandler serves the chat endpoints with an injected model provider and stores
+type chatHandler struct {
+	provider llm.ChatProvider
+	registry *function_calling.Registry
+	stores   *repository.Stores
+}
+
+// newChatHandler creates the chat handlers. A nil provider means the AI is not
+// configured and chat requests are answered with 503.
+func newChatHandler(provider llm.ChatProvider, registry *function_calling.Registry, stores *repository.Stores) *chatHandler {
+	return &chatHandler{provider: provider, registry: registry, stores: stores}
+}
+
+// chatTurn holds everything needed to answer a new user turn of a conversation
+type chatTurn struct {
+	conversations  repository.ConversationStore
+	conversationID string
+	messages       []openai.ChatCompletionMessage
+	userMessages   []function_calling.UserMessage
+	state          *booking_flow.State
+}
+
+// persist stores an assistant reply or tool result of the turn
+func (t *chatTurn) persist(message openai.ChatCompletionMessage) error {
+	return saveConversationMessage(t.conversations, t.conversationID, message)
+}
+
+// saveState stores the booking dialogue state after a tool changed it
+func (t *chatTurn) saveState() error {
+	encoded, err := t.state.Encode()
+	if err != nil {
+		return err
+	}
+	return t.conversations.UpdateConversationBookingState(t.conversationID, encoded)
+}
+
+// startChatTurn binds the request, stores the new user turn and rebuilds the
+// conversation context. It writes the error response itself and returns false on failure.
+func (h *chatHandler) startChatTurn(c *gin.Context) (*chatTurn, bool) {
+	if h.provider == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI provider not configured"})
+		return nil, false
+	}
+
+	var req ChatRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return nil, false
+	}
+
+	conversation, err := h.stores.Conversations.GetConversationByID(req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat session"})
+		return nil, false
+	}
+
+	if conversation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat session not found"})
+		return nil, false
+	}
+
+	state, err := booking_flow.Load(conversation.BookingState)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking state"})
+		return nil, false
+	}
+
+	turn := &chatTurn{conversations: h.stores.Conversations, conversationID: conversation.ID, state: state}
+
+	// Store the new user turn, if timestamp is provided, prepend it to the content
+	content := req.Message
+	if req.Timestamp != "" {
+		content = "time:" + req.Timestamp + "\n" + content
+	}
+
+	if err := turn.persist(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chat message"})
+		return nil, false
+	}
+
+	// Rebuild the context from storage
+	openaiMessages, userMessages, err := loadConversationMessages(h.stores.Conversations, conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat messages"})
+		return nil, false
+	}
+	turn.userMessages = userMessages
+
+	// Add system message to provide context about the resort booking assistant
+	systemMessage := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: systemPrompt,
+	}
+
+	// Prepend system message to the messages array
+	turn.messages = append([]openai.ChatCompletionMessage{systemMessage}, openaiMessages...)
+
+	return turn, true
+}
+
+// chatWithAI handles the AI chat functionality
+func (h *chatHandler) chatWithAI(c *gin.Context) {
+	turn, ok := h.startChatTurn(c)
+	if !ok {
+		return
+	}
+
+	reply := &replyBuilder{state: turn.state, houses: h.stores.Houses}
+	complete := func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+		message, err := h.provider.CreateChatCompletion(ctx, req)
+		if err == nil {
+			reply.Write(message.Content)
+		}
+		return message, err
+	}
+
+	if err := h.runChatCompletion(c.Request.Context(), turn, complete, reply); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get response from AI", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ChatResponse{
+		SessionID: turn.conversationID,
+		Parts:     reply.parts,
+	})
+}
+
+// streamChatWithAI handles the AI chat functionality over Server-Sent Events.
+// Text is sent as "delta" events while it arrives, every other part as a "part"
+// event as soon as it is complete, and the whole response as a "done" event.
+func (h *chatHandler) streamChatWithAI(c *gin.Context) {
+	turn, ok := h.startChatTurn(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering so deltas arrive immediately
+
+	send := func(event string, data interface{}) {
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	reply := &replyBuilder{
+		state:  turn.state,
+		houses: h.stores.Houses,
+		onText: func(text string) { send("delta", gin.H{"content": text}) },
+		onPart: func(part ChatPart) { send("part", part) },
+	}
+	complete := func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+		return h.provider.CreateChatCompletionStream(ctx, req, reply.Write)
+	}
+
+	if err := h.runChatCompletion(c.Request.Context(), turn, complete, reply); err != nil {
+		send("error", gin.H{"error": "Failed to get response from AI", "details": err.Error()})
+		return
+	}
+
+	send("done", ChatResponse{
+		SessionID: turn.conversationID,
+		Parts:     reply.parts,
+	})
+}
+
+// loadConversationMessages rebuilds the model context of a conversation from storage.
+// The user turns are also returned on their own, without the time prefix, so tools can
+// check the model's interpretation against what the user wrote.
+func loadConversationMessages(conversations repository.ConversationStore, conversationID string) ([]openai.ChatCompletionMessage, []function_calling.UserMessage, error) {
+	stored, err := conversations.GetConversationMessages(conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var userMessages []function_calling.UserMessage
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(stored))
+	for _, msg := range stored {
+		message := openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCallID: msg.ToolCallID,
+		}
+		if msg.ToolCalls != "" {
+			if err := json.Unmarshal([]byte(msg.ToolCalls), &message.ToolCalls); err != nil {
+				return nil, nil, fmt.Errorf("invalid tool calls in message %d: %v", msg.ID, err)
+			}
+		}
+		messages = append(messages, message)
+
+		if msg.Role == openai.ChatMessageRoleUser {
+			text := msg.Content
+			if strings.HasPrefix(text, "time:") {
+				if newline := strings.Index(text, "\n"); newline != -1 {
+					text = text[newline+1:]
+				}
+			}
+			userMessages = append(userMessages, function_calling.UserMessage{Text: text, SentAt: msg.CreatedAt})
+		}
+	}
+
+	return messages, userMessages, nil
+}
+
+// saveConversationMessage stores a user turn, assistant reply or tool result
+func saveConversationMessage(conversations repository.ConversationStore, conversationID string, message openai.ChatCompletionMessage) error {
+	stored := &models.ConversationMessage{
+		ConversationID: conversationID,
+		Role:           message.Role,
+		Content:        message.Content,
+		Name:           message.Name,
+		ToolCallID:     message.ToolCallID,
+	}
+
+	if len(message.ToolCalls) > 0 {
+		toolCalls, err := json.Marshal(message.ToolCalls)
+		if err != nil {
+			return err
+		}
+		stored.ToolCalls = string(toolCalls)
+	}
+
+	return conversations.AddConversationMessage(stored)
+}
+
+// completionFunc requests a single assistant message from the model
+type completionFunc func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error)
+
+// runChatCompletion sends the conversation to the model and executes the tool calls it
+// returns, feeding the results back until the model produces a final answer.
+// Every assistant reply and tool result is persisted as soon as it exists. complete
+// writes the assistant text to reply, the tool results are added to it here.
+func (h *chatHandler) runChatCompletion(ctx context.Context, turn *chatTurn, complete completionFunc, reply *replyBuilder) error {
+	// Tools read and update the booking dialogue state of the conversation
+	ctx = booking_flow.WithState(ctx, turn.state)
+	ctx = function_calling.WithUserMessages(ctx, turn.userMessages)
+	ctx = function_calling.WithConversationID(ctx, turn.conversationID)
+
+	messages := turn.messages
+	for round := 0; round <= maxToolRounds; round++ {
+		// The model is told the current step and missing slots on every round
+		stateMessage := openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: turn.state.Instructions(),
+		}
+
+		// The provider fills in the model and sampling parameters
+		message, err := complete(ctx, openai.ChatCompletionRequest{
+			Messages: append(messages[:len(messages):len(messages)], stateMessage),
+			Tools:    h.registry.Definitions(),
+		})
+		if err != nil {
+			return err
+		}
+		reply.EndMessage()
+
+		if err := turn.persist(message); err != nil {
+			return err
+		}
+
+		if len(message.ToolCalls) == 0 {
+			return nil
+		}
+
+		// Keep the assistant turn with its tool calls so the results can refer to them
+		messages = append(messages, message)
+		for _, call := range message.ToolCalls {
+			toolResult, err := h.registry.Execute(ctx, call)
+			if err != nil {
+				return err
+			}
+
+			toolMessage := openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    toolResult.Content,
+				Name:       call.Function.Name,
+				ToolCallID: call.ID,
+			}
+			if err := turn.persist(toolMessage); err != nil {
+				return err
+			}
+			if err := turn.saveState(); err != nil {
+				return err
+			}
+
+			messages = append(messages, toolMessage)
+			reply.AddToolResult(toolResult)
+		}
+	}
+
+	return fmt.Errorf("AI did not produce a final answer after %d tool rounds", maxToolRounds)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"resort-app-server/booking_ref"
+	"resort-app-server/models"
+	"resort-app-server/phone_number"
+	"resort-app-server/phone_verification"
+	"resort-app-server/pricing"
+	"resort-app-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minPhoneDigits is how many trailing digits of the phone number a guest has to give
+const minPhoneDigits = 4
+
+// Failed lookups of a reference code are limited, so the phone digits cannot be guessed
+const (
+	maxGuestLookupFailures = 5
+	guestLookupWindow      = 15 * time.Minute
+)
+
+// guestHandler lets guests look up their own booking without a staff account
+type guestHandler struct {
+	stores   *repository.Stores
+	verifier *phone_verification.Verifier // nil when no code is needed
+	limiter  *lookupLimiter
+}
+
+// newGuestHandler returns a guestHandler backed by stores. With a verifier guests also have
+// to enter a code sent to the phone number of the booking.
+func newGuestHandler(stores *repository.Stores, verifier *phone_verification.Verifier) *guestHandler {
+	return &guestHandler{stores: stores, verifier: verifier, limiter: newLookupLimiter(maxGuestLookupFailures, guestLookupWindow)}
+}
+
+// guestBooking is the view of a booking shown to guests, without the staff-only fields and
+// with the contact details masked
+type guestBooking struct {
+	Reference    string  `json:"reference"`
+	HouseName    string  `json:"house_name"`
+	CheckIn      string  `json:"check_in"`
+	CheckOut     string  `json:"check_out"`
+	Nights       int     `json:"nights"`
+	Guests       int     `json:"guests"`
+	Status       string  `json:"status"`
+	TotalPrice   float64 `json:"total_price"`
+	CustomerName string  `json:"customer_name"`
+	PhoneNumber  string  `json:"phone_number"`
+}
+
+// newGuestBooking returns the guest view of a booking
+func newGuestBooking(booking *models.Booking) guestBooking {
+	nights, _ := pricing.Nights(booking.CheckIn, booking.CheckOut)
+	return guestBooking{
+		Reference:    booking.Reference,
+		HouseName:    booking.ResortName,
+		CheckIn:      booking.CheckIn,
+		CheckOut:     booking.CheckOut,
+		Nights:       nights,
+		Guests:       booking.Guests,
+		Status:       booking.Status,
+		TotalPrice:   booking.TotalPrice,
+		CustomerName: maskName(booking.CustomerName),
+		PhoneNumber:  maskPhone(booking.PhoneNumber),
+	}
+}
+
+// getGuestBooking returns the booking with a reference code when the phone query parameter
+// holds at least the last four digits of its phone number and, with phone verification,
+// the code query parameter holds the code sent by sendGuestCode
+func (h *guestHandler) getGuestBooking(c *gin.Context) {
+	booking := h.findBooking(c, c.Query("phone"))
+	if booking == nil {
+		return
+	}
+
+	if h.verifier != nil {
+		code := c.Query("code")
+		if code == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "A verification code is required, request one with POST /api/guest/bookings/:ref/code", "verification_required": true})
+			return
+		}
+
+		err := h.verifier.Check(guestVerificationScope(booking), booking.PhoneNumber, code)
+		var wrongCode *phone_verification.WrongCodeError
+		switch {
+		case errors.As(err, &wrongCode):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code", "attempts_left": wrongCode.AttemptsLeft})
+			return
+		case err == phone_verification.ErrNoCode, err == phone_verification.ErrCodeExpired, err == phone_verification.ErrTooManyAttempts:
+			message := err.Error()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": strings.ToUpper(message[:1]) + message[1:] + ", request a new code"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check the verification code"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"booking": newGuestBooking(booking)})
+}
+
+// sendGuestCode sends a verification code to the phone number of a booking, once the guest
+// gave at least the last four digits of it
+func (h *guestHandler) sendGuestCode(c *gin.Context) {
+	if h.verifier == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Phone verification is disabled, no code is needed"})
+		return
+	}
+
+	var request struct {
+		Phone string `json:"phone" binding:"required"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	booking := h.findBooking(c, request.Phone)
+	if booking == nil {
+		return
+	}
+
+	err := h.verifier.Send(c.Request.Context(), guestVerificationScope(booking), booking.PhoneNumber)
+	var tooSoon *phone_verification.TooSoonError
+	if errors.As(err, &tooSoon) {
+		c.Header("Retry-After", strconv.Itoa(int(tooSoon.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A code was sent a moment ago, wait before requesting a new one"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to send a verification code for booking %d: %v", booking.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send the verification code"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "A verification code was sent to the phone number of the booking",
+		"phone_number": maskPhone(booking.PhoneNumber),
+		"expires_in":   int(h.verifier.CodeTTL().Seconds()),
+	})
+}
+
+// findBooking returns the booking with the reference code of the request when phone is its
+// phone number, in any form phone_number.Normalize accepts, or holds at least its last four
+// digits. Otherwise it answers the request and returns nil. Unknown codes and wrong digits
+// get the same answer, so the response does not tell whether a code exists.
+func (h *guestHandler) findBooking(c *gin.Context, phone string) *models.Booking {
+	// A full number is compared in E.164 form, the form the booking keeps it in
+	fullNumber, err := phone_number.Normalize(phone)
+	if err != nil {
+		fullNumber = ""
+	}
+
+	phone = digitsOnly(phone)
+	if len(phone) < minPhoneDigits {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The phone parameter needs at least the last " + strconv.Itoa(minPhoneDigits) + " digits of the phone number"})
+		return nil
+	}
+
+	reference := booking_ref.Normalize(c.Param("ref"))
+	if reference == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return nil
+	}
+
+	if retryAfter := h.limiter.blockedFor(reference); retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed lookups of this booking, try again later"})
+		return nil
+	}
+
+	booking, err := h.stores.Bookings.GetBookingByReference(reference)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking"})
+		return nil
+	}
+	if booking == nil || !guestPhoneMatches(booking, fullNumber, phone) {
+		h.limiter.fail(reference)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return nil
+	}
+	return booking
+}
+
+// guestPhoneMatches reports whether the phone number given by a guest is the one of the
+// booking: fullNumber when it parsed as a full number, otherwise the trailing digits
+func guestPhoneMatches(booking *models.Booking, fullNumber, digits string) bool {
+	if fullNumber != "" {
+		return booking.PhoneNumber == fullNumber
+	}
+	return strings.HasSuffix(digitsOnly(booking.PhoneNumber), digits)
+}
+
+// guestVerificationScope returns the scope of the codes that unlock a booking
+func guestVerificationScope(booking *models.Booking) string {
+	return "guest " + booking.Reference
+}
+
+// digitsOnly returns the digits of s
+func digitsOnly(s string) string {
+	var digits strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+// maskName keeps the first letter of every part of a name, "Budi Santoso" becomes "B*** S******"
+func maskName(name string) string {
+	parts := strings.Fields(name)
+	for i, part := range parts {
+		letters := []rune(part)
+		parts[i] = string(letters[0]) + strings.Repeat("*", len(letters)-1)
+	}
+	return strings.Join(parts, " ")
+}
+
+// maskPhone hides every digit of a phone number but the last minPhoneDigits
+func maskPhone(phone string) string {
+	keep := minPhoneDigits
+	masked := []rune(phone)
+	for i := len(masked) - 1; i >= 0; i-- {
+		if masked[i] < '0' || masked[i] > '9' {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		masked[i] = '*'
+	}
+	return string(masked)
+}
+
+// lookupLimiter counts the failed lookups of each key and blocks a key for the rest of the
+// window once it failed max times
+type lookupLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]*lookupFailures
+}
+
+type lookupFailures struct {
+	count int
+	since time.Time
+}
+
+func newLookupLimiter(max int, window time.Duration) *lookupLimiter {
+	return &lookupLimiter{max: max, window: window, failures: make(map[string]*lookupFailures)}
+}
+
+// blockedFor returns how long key is still blocked, 0 when it is not
+func (l *lookupLimiter) blockedFor(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures, ok := l.failures[key]
+	if !ok || failures.count < l.max {
+		return 0
+	}
+	return time.Until(failures.since.Add(l.window))
+}
+
+// fail records a failed lookup of key
+func (l *lookupLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, failures := range l.failures {
+		if now.Sub(failures.since) >= l.window {
+			delete(l.failures, k)
+		}
+	}
+
+	failures, ok := l.failures[key]
+	if !ok {
+		failures = &lookupFailures{since: now}
+		l.failures[key] = failures
+	}
+	failures.count++
+}
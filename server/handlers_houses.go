@@ -3,16 +3,21 @@ package main
 import (
 	"net/http"
 	"strconv"
+	"time"
 
-	"resort-app-server/models"
 	"resort-app-server/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
+// houseHandler serves the house catalog endpoints on the injected stores
+type houseHandler struct {
+	stores *repository.Stores
+}
+
 // getHouses returns all houses
-func getHouses(c *gin.Context) {
-	houses, err := repository.GetHouses()
+func (h *houseHandler) getHouses(c *gin.Context) {
+	houses, err := h.stores.Houses.GetHouses()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve houses"})
 		return
@@ -24,8 +29,9 @@ func getHouses(c *gin.Context) {
 	})
 }
 
-// getHousesByGuests returns houses that can accommodate the specified number of guests
-func getHousesByGuests(c *gin.Context) {
+// getHousesByGuests returns houses that can accommodate the specified number of guests,
+// limited to the houses that are free when check_in (and optionally check_out) is given
+func (h *houseHandler) getHousesByGuests(c *gin.Context) {
 	// Get the guests parameter from query
 	guestsParam := c.Query("guests")
 	if guestsParam == "" {
@@ -40,21 +46,33 @@ func getHousesByGuests(c *gin.Context) {
 		return
 	}
 
-	// Get all houses
-	houses, err := repository.GetHouses()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve houses"})
+	// Optional stay dates exclude houses that are already booked
+	checkIn, checkOut := c.Query("check_in"), c.Query("check_out")
+	if checkIn == "" && checkOut != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "check_in parameter is required when check_out is given"})
 		return
 	}
-
-	// Filter houses based on guest capacity
-	var filteredHouses []models.House
-	for _, house := range houses {
-		if house.Guests >= guests {
-			filteredHouses = append(filteredHouses, house)
+	if checkIn != "" {
+		start, err := time.Parse(repository.DateLayout, checkIn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "check_in must be a date in YYYY-MM-DD format"})
+			return
+		}
+		if checkOut != "" {
+			end, err := time.Parse(repository.DateLayout, checkOut)
+			if err != nil || !end.After(start) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "check_out must be a date in YYYY-MM-DD format after check_in"})
+				return
+			}
 		}
 	}
 
+	filteredHouses, err := h.stores.AvailableHouses(guests, checkIn, checkOut)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve houses"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"houses": filteredHouses,
 		"count":  len(filteredHouses),
@@ -62,14 +80,14 @@ func getHousesByGuests(c *gin.Context) {
 }
 
 // getHouse returns a specific house by ID
-func getHouse(c *gin.Context) {
+func (h *houseHandler) getHouse(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid house ID"})
 		return
 	}
 
-	house, err := repository.GetHouseByID(id)
+	house, err := h.stores.Houses.GetHouseByID(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve house"})
 		return
@@ -84,14 +102,14 @@ func getHouse(c *gin.Context) {
 }
 
 // searchHouses searches for houses by name or location
-func searchHouses(c *gin.Context) {
+func (h *houseHandler) searchHouses(c *gin.Context) {
 	query := c.Param("query")
 	if query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
 		return
 	}
 
-	houses, err := repository.SearchHouses(query)
+	houses, err := h.stores.Houses.SearchHouses(query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search houses"})
 		return
@@ -0,0 +1,160 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"resort-app-server/auth"
+	"resort-app-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header is the request header carrying the idempotency key chosen by the client
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed from an earlier request with the same key
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxKeyLength is the longest key accepted, clients usually send a UUID
+const maxKeyLength = 255
+
+// replayedHeaders are the response headers stored with a response and sent again when it
+// is replayed, the ETag is needed for the If-Match of the next update
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Hash returns the hex SHA-256 of a request or payload, used to detect a key reused for a
+// different request
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Middleware returns a Gin middleware that makes a route safe to retry. Of the requests
+// with the same Idempotency-Key only the first one runs. Once it has succeeded, repeating
+// it with the same body replays its response for ttl; while it runs, repeats get 409. A
+// failed request releases its key so it can be retried. Keys are scoped to the route and
+// the caller, requests without the header are not affected.
+func Middleware(store repository.IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(Header))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most " + strconv.Itoa(maxKeyLength) + " characters"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scopedKey := strings.Join([]string{c.Request.Method, c.FullPath(), caller(c), key}, " ")
+		requestHash := Hash(body)
+
+		record, err := store.ReserveIdempotencyKey(scopedKey, requestHash, time.Now().Add(ttl))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if record != nil {
+			switch {
+			case record.RequestHash != requestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case record.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			default:
+				contentType := "application/json; charset=utf-8"
+				for name, value := range record.Headers {
+					if name == "Content-Type" {
+						contentType = value
+						continue
+					}
+					c.Header(name, value)
+				}
+				c.Header(ReplayedHeader, "true")
+				c.Data(record.StatusCode, contentType, []byte(record.Response))
+				c.Abort()
+			}
+			return
+		}
+
+		// A handler that panics is answered by the recovery middleware, its key is released
+		// on the way so a retry does not wait for the key to expire
+		finished := false
+		defer func() {
+			if finished {
+				return
+			}
+			if err := store.ReleaseIdempotencyKey(scopedKey); err != nil {
+				log.Printf("Failed to release Idempotency-Key: %v", err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		finished = true
+
+		if status := recorder.Status(); status >= 200 && status < 300 {
+			err = store.CompleteIdempotencyKey(scopedKey, status, responseHeaders(recorder.Header()), recorder.body.String())
+		} else {
+			err = store.ReleaseIdempotencyKey(scopedKey)
+		}
+		if err != nil {
+			log.Printf("Failed to record Idempotency-Key outcome: %v", err)
+		}
+	}
+}
+
+// responseHeaders returns the replayedHeaders set on a response
+func responseHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// caller identifies who sent the request, so clients cannot replay each other's responses
+func caller(c *gin.Context) string {
+	identity := auth.GetIdentity(c)
+	switch {
+	case identity == nil:
+		return "anonymous"
+	case identity.StaffID != 0:
+		return "staff:" + strconv.Itoa(identity.StaffID)
+	default:
+		return "access:" + identity.Email
+	}
+}
+
+// responseRecorder keeps a copy of the response body written by the handlers
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
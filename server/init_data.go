@@ -2,14 +2,16 @@ package main
 
 import (
 	"log"
+	"resort-app-server/auth"
+	"resort-app-server/config"
 	"resort-app-server/models"
 	"resort-app-server/repository"
 )
 
 // initSampleData initializes the database with sample data
-func initSampleData() {
+func initSampleData(stores *repository.Stores) {
 	// Check if we already have data
-	bookings, err := repository.GetAllBookings()
+	bookings, err := stores.Bookings.GetAllBookings()
 	if err != nil {
 		log.Fatal("Failed to check existing bookings:", err)
 	}
@@ -22,7 +24,7 @@ func initSampleData() {
 		sampleBookings := []models.Booking{
 			{
 				UserID:       101,
-				ResortName:   "Paradise Beach Resort",
+				ResortName:   "Beach House",
 				CheckIn:      "2025-10-15",
 				CheckOut:     "2025-10-20",
 				Guests:       2,
@@ -33,18 +35,18 @@ func initSampleData() {
 			},
 			{
 				UserID:       102,
-				ResortName:   "Mountain View Lodge",
+				ResortName:   "Mountain Cabin",
 				CheckIn:      "2025-11-05",
 				CheckOut:     "2025-11-10",
 				Guests:       4,
 				TotalPrice:   2100.00,
 				Status:       "confirmed",
 				CustomerName: "Jane Doe",
-				PhoneNumber:  "+0987654321",
+				PhoneNumber:  "+62987654321",
 			},
 			{
 				UserID:       103,
-				ResortName:   "Urban Luxury Hotel",
+				ResortName:   "City Apartment",
 				CheckIn:      "2025-09-20",
 				CheckOut:     "2025-09-25",
 				Guests:       2,
@@ -55,9 +57,16 @@ func initSampleData() {
 			},
 		}
 
-		// Insert sample bookings
+		// Insert sample bookings, linked to their house in the catalog
 		for i := range sampleBookings {
-			err := repository.CreateBooking(&sampleBookings[i])
+			house, err := stores.Houses.GetHouseByName(sampleBookings[i].ResortName)
+			if err != nil || house == nil {
+				log.Printf("Skipping sample booking for unknown house %s", sampleBookings[i].ResortName)
+				continue
+			}
+			sampleBookings[i].HouseID = house.ID
+
+			err = stores.Bookings.CreateBooking(&sampleBookings[i])
 			if err != nil {
 				log.Printf("Failed to create booking: %v", err)
 			} else {
@@ -70,3 +79,36 @@ func initSampleData() {
 		log.Println("Database already contains data, skipping initialization")
 	}
 }
+
+// initAdminAccount creates the first admin from ADMIN_USERNAME and ADMIN_PASSWORD when
+// there are no staff accounts yet. Further accounts are created through the admin API.
+func initAdminAccount(stores *repository.Stores, cfg config.AuthConfig) {
+	count, err := stores.Staff.CountStaff()
+	if err != nil {
+		log.Fatal("Failed to check existing staff accounts:", err)
+	}
+	if count > 0 {
+		return
+	}
+
+	password := cfg.AdminPassword
+	if password == "" {
+		log.Println("No staff accounts exist, set ADMIN_PASSWORD to create the first admin")
+		return
+	}
+	if err := auth.ValidatePassword(password); err != nil {
+		log.Fatal("Invalid ADMIN_PASSWORD: ", err)
+	}
+
+	username := cfg.AdminUsername
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Fatal("Failed to hash ADMIN_PASSWORD:", err)
+	}
+
+	admin := &models.Staff{Username: username, PasswordHash: hash, Role: auth.RoleAdmin}
+	if err := stores.Staff.CreateStaff(admin); err != nil {
+		log.Fatal("Failed to create the admin account:", err)
+	}
+	log.Printf("Created admin account %s", username)
+}
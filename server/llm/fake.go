@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// FakeResponse is one canned answer of the fake provider
+type FakeResponse struct {
+	Content   string         `json:"content"`
+	ToolCalls []FakeToolCall `json:"tool_calls,omitempty"`
+}
+
+// FakeToolCall is a canned tool call, arguments are given as a JSON object
+type FakeToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// FakeProvider replays canned responses in order, one per completion request.
+// It never talks to a model, which makes the chat path deterministic.
+type FakeProvider struct {
+	mu        sync.Mutex
+	responses []FakeResponse
+	next      int
+	requests  []openai.ChatCompletionRequest
+}
+
+// NewFakeProvider creates a fake provider that replays the given responses
+func NewFakeProvider(responses ...FakeResponse) *FakeProvider {
+	return &FakeProvider{responses: responses}
+}
+
+// NewFakeProviderFromFile creates a fake provider from a JSON array of FakeResponse
+func NewFakeProviderFromFile(path string) (*FakeProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("fake LLM script not configured")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []FakeResponse
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("invalid fake LLM script %s: %v", path, err)
+	}
+
+	return NewFakeProvider(responses...), nil
+}
+
+// CreateChatCompletion implements ChatProvider
+func (p *FakeProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	if p.next >= len(p.responses) {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("fake LLM script exhausted after %d responses", len(p.responses))
+	}
+
+	response := p.responses[p.next]
+	p.next++
+
+	message := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: response.Content,
+	}
+	for i, call := range response.ToolCalls {
+		arguments := string(call.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:   fmt.Sprintf("call_fake_%d_%d", p.next, i),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+
+	return message, nil
+}
+
+// CreateChatCompletionStream implements ChatProvider, the content is streamed word by word
+func (p *FakeProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionMessage, error) {
+	message, err := p.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return message, err
+	}
+
+	for _, word := range strings.SplitAfter(message.Content, " ") {
+		if word != "" {
+			onDelta(word)
+		}
+	}
+
+	return message, nil
+}
+
+// Requests returns the requests received so far
+func (p *FakeProvider) Requests() []openai.ChatCompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]openai.ChatCompletionRequest(nil), p.requests...)
+}
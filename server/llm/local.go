@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultLocalBaseURL is the OpenAI-compatible endpoint of a default Ollama install.
+// llama.cpp's server exposes the same API, usually on http://localhost:8080/v1.
+const defaultLocalBaseURL = "http://localhost:11434/v1"
+
+// defaultLocalModel is used when LOCAL_LLM_MODEL is not set
+const defaultLocalModel = "llama3.1"
+
+// LocalProvider talks to a self-hosted model served by Ollama or llama.cpp
+// through their OpenAI-compatible chat completions API
+type LocalProvider struct {
+	*OpenAIProvider
+}
+
+// NewLocalProvider creates a provider for a local model server.
+// Local servers do not check the API key, so none is required.
+func NewLocalProvider(cfg Config) (*LocalProvider, error) {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultLocalBaseURL
+	}
+	if !strings.HasPrefix(cfg.BaseURL, "http://") && !strings.HasPrefix(cfg.BaseURL, "https://") {
+		return nil, fmt.Errorf("invalid local LLM base URL: %s", cfg.BaseURL)
+	}
+	if cfg.Model == "" {
+		cfg.Model = defaultLocalModel
+	}
+	if cfg.APIKey == "" {
+		cfg.APIKey = "local"
+	}
+
+	provider, err := NewOpenAIProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalProvider{OpenAIProvider: provider}, nil
+}
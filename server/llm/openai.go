@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OpenAIProvider talks to the OpenAI API or any OpenAI-compatible endpoint
+type OpenAIProvider struct {
+	client *openai.Client
+	cfg    Config
+}
+
+// NewOpenAIProvider creates a provider backed by the go-openai client
+func NewOpenAIProvider(cfg Config) (*OpenAIProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not configured")
+	}
+
+	// Fall back to GPT-3.5 Turbo when no model is configured
+	if cfg.Model == "" {
+		cfg.Model = openai.GPT3Dot5Turbo
+	}
+
+	// Create OpenAI client with custom configuration
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = cfg.BaseURL
+	}
+
+	return &OpenAIProvider{
+		client: openai.NewClientWithConfig(clientConfig),
+		cfg:    cfg,
+	}, nil
+}
+
+// CreateChatCompletion implements ChatProvider
+func (p *OpenAIProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.cfg.applySettings(req))
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("AI returned no choices")
+	}
+
+	return resp.Choices[0].Message, nil
+}
+
+// CreateChatCompletionStream implements ChatProvider
+func (p *OpenAIProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionMessage, error) {
+	req = p.cfg.applySettings(req)
+	req.Stream = true
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	defer stream.Close()
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var content strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return openai.ChatCompletionMessage{}, err
+		}
+
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+
+		message.ToolCalls = mergeToolCallFragments(message.ToolCalls, delta.ToolCalls)
+	}
+
+	message.Content = content.String()
+	return message, nil
+}
+
+// mergeToolCallFragments adds streamed tool call fragments to the calls assembled so far.
+// The index of a fragment tells which call it belongs to.
+func mergeToolCallFragments(calls []openai.ToolCall, fragments []openai.ToolCall) []openai.ToolCall {
+	for _, fragment := range fragments {
+		index := len(calls) - 1
+		if fragment.Index != nil {
+			index = *fragment.Index
+		} else if fragment.ID != "" {
+			index = len(calls)
+		}
+		if index < 0 {
+			index = 0
+		}
+
+		for len(calls) <= index {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+
+		call := &calls[index]
+		if fragment.ID != "" {
+			call.ID = fragment.ID
+		}
+		if fragment.Type != "" {
+			call.Type = fragment.Type
+		}
+		call.Function.Name += fragment.Function.Name
+		call.Function.Arguments += fragment.Function.Arguments
+	}
+
+	return calls
+}
@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatProvider is a chat model backend. Requests and messages use the OpenAI
+// chat completion types, which every provider understands or translates.
+type ChatProvider interface {
+	// CreateChatCompletion returns the assistant message for the conversation in req
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error)
+	// CreateChatCompletionStream streams the answer, calling onDelta for every content
+	// fragment, and returns the assembled assistant message including tool calls
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionMessage, error)
+}
+
+// Config holds the settings used to build a ChatProvider, see config.LLMConfig
+type Config struct {
+	Provider         string // openai, local or fake
+	APIKey           string
+	BaseURL          string
+	Model            string
+	Temperature      float32
+	TopP             float32
+	MaxTokens        int // 0 means no limit
+	PresencePenalty  float32
+	FrequencyPenalty float32
+	FakeScriptPath   string // JSON file with the canned responses of the fake provider
+}
+
+// New creates the provider selected by cfg.Provider
+func New(cfg Config) (ChatProvider, error) {
+	var provider ChatProvider
+	var err error
+
+	// Assign through the concrete constructors so a failed one never yields a non-nil interface
+	switch cfg.Provider {
+	case "openai":
+		var p *OpenAIProvider
+		if p, err = NewOpenAIProvider(cfg); err == nil {
+			provider = p
+		}
+	case "local":
+		var p *LocalProvider
+		if p, err = NewLocalProvider(cfg); err == nil {
+			provider = p
+		}
+	case "fake":
+		var p *FakeProvider
+		if p, err = NewFakeProviderFromFile(cfg.FakeScriptPath); err == nil {
+			provider = p
+		}
+	default:
+		err = fmt.Errorf("unknown LLM provider: %s", cfg.Provider)
+	}
+
+	return provider, err
+}
+
+// applySettings fills in the model and sampling parameters of a request
+func (cfg Config) applySettings(req openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	req.Model = cfg.Model
+	req.Temperature = cfg.Temperature
+	req.TopP = cfg.TopP
+	req.MaxTokens = cfg.MaxTokens
+	req.PresencePenalty = cfg.PresencePenalty
+	req.FrequencyPenalty = cfg.FrequencyPenalty
+	return req
+}
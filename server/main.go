@@ -3,45 +3,109 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
+	"resort-app-server/auth"
+	"resort-app-server/booking_lifecycle"
+	"resort-app-server/config"
+	"resort-app-server/cors"
 	"resort-app-server/database"
+	"resort-app-server/date_resolver"
+	"resort-app-server/idempotency"
+	"resort-app-server/llm"
+	"resort-app-server/phone_verification"
+	"resort-app-server/repository"
+	"resort-app-server/sms"
+	"resort-app-server/tool_calling/function_calling"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Load environment variables from root .env file
-	err := godotenv.Load("../.env")
+	// Load the settings from the environment, .env and CONFIG_FILE
+	cfg, err := config.Load()
 	if err != nil {
-		// Try to load from current directory as fallback
-		err = godotenv.Load(".env")
-		if err != nil {
-			log.Println("No .env file found, using default settings")
-		}
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// `migrate` manages the database schema and `config` shows the settings instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(cfg, os.Args[2:]))
 	}
 
-	// Initialize database
-	database.InitDB()
-	defer database.DB.Close()
+	date_resolver.SetLocation(cfg.Resort.Location())
+
+	// Initialize the stores selected by DATABASE_URL
+	var stores *repository.Stores
+	if database.IsMemoryURL(cfg.Database.URL) {
+		log.Println("Using in-memory stores, data is lost when the server stops")
+		stores = repository.NewMemoryStores()
+	} else {
+		stores = repository.NewSQLStores(database.InitDB(cfg.Database.URL, cfg.Database.Path, cfg.Database.MigrateOnStart))
+	}
+	defer stores.Close()
+
+	// Seed the house catalog on first start, bookings reference its houses
+	if err := stores.SeedHouses(); err != nil {
+		log.Fatal("Failed to seed the house catalog:", err)
+	}
+	if err := stores.Bookings.BackfillBookingHouses(); err != nil {
+		log.Fatal("Failed to link bookings to houses:", err)
+	}
+	if err := stores.Bookings.BackfillBookingReferences(); err != nil {
+		log.Fatal("Failed to give bookings a reference code:", err)
+	}
 
 	// Initialize sample data
-	initSampleData()
+	initSampleData(stores)
+	initAdminAccount(stores, cfg.Auth)
 
-	// Set Gin to release mode in production
-	if os.Getenv("GIN_MODE") != "debug" {
-		gin.SetMode(gin.ReleaseMode)
+	// Initialize the chat model provider selected by LLM_PROVIDER
+	provider, err := llm.New(cfg.LLM.ProviderConfig())
+	if err != nil {
+		log.Printf("AI chat disabled: %v", err)
+	}
+	// Phone numbers of chat bookings and guest lookups are verified with a one-time code
+	var verifier *phone_verification.Verifier
+	if cfg.Verification.Enabled {
+		sender, err := sms.New(cfg.SMS.SenderConfig())
+		if err != nil {
+			log.Fatalf("Failed to set up the SMS sender: %v", err)
+		}
+		if cfg.SMS.Provider == "log" {
+			log.Println("WARNING: PHONE_VERIFICATION_ENABLED is true but SMS_PROVIDER is log, verification codes are only written to the server log. " +
+				"Guests cannot finish a chat booking or look up a booking without someone reading the log; the log sender is for local development only, use SMS_PROVIDER=twilio in production")
+		}
+		verifier = phone_verification.New(stores.Verifications, sender, cfg.Verification.VerifierConfig())
+	} else {
+		log.Println("Phone verification is disabled, set SMS_PROVIDER=twilio to verify the phone numbers of bookings")
 	}
 
+	chatHandlers := newChatHandler(provider, function_calling.NewDefaultRegistry(stores, verifier), stores)
+	houseHandlers := &houseHandler{stores: stores}
+	bookingHandlers := &bookingHandler{stores: stores}
+	authHandlers := &authHandler{stores: stores, tokens: newTokenSigner(cfg.Auth)}
+	staffHandlers := &staffHandler{stores: stores}
+	guestHandlers := newGuestHandler(stores, verifier)
+
+	// Cloudflare Access guards the staff routes when CF_ZERO_TRUST_ENABLED is true
+	cloudflareAccess := cfg.CloudflareAccess.ValidateCloudflareAccessJWT()
+
+	// Staff roles allowed on the protected routes, the chat and house catalog stay public
+	anyStaff := auth.RequireRole(auth.RoleAdmin, auth.RoleReceptionist, auth.RoleReadOnly)
+	bookingStaff := auth.RequireRole(auth.RoleAdmin, auth.RoleReceptionist)
+	adminOnly := auth.RequireRole(auth.RoleAdmin)
+
+	// Gin runs in release mode unless GIN_MODE says otherwise
+	gin.SetMode(cfg.Server.GinMode)
+
 	// Create Gin router
 	router := gin.Default()
 
-	// Zero Trust Security: Configure CORS with strict policies
-	allowedOrigin := os.Getenv("ALLOWED_ORIGINS")
-	if allowedOrigin == "" {
-		allowedOrigin = "https://okiabrian.my.id"
-	}
-
 	// Add security headers middleware
 	router.Use(func(c *gin.Context) {
 		// Zero Trust Security: Set security headers
@@ -51,32 +115,15 @@ func main() {
 		c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
 		c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'")
 
-		// Configure CORS with strict policies for Zero Trust
-		// Allow both the production domain and localhost for development
-		origin := c.Request.Header.Get("Origin")
-		if origin == "http://localhost:8085" {
-			c.Header("Access-Control-Allow-Origin", "http://localhost:8085")
-		} else if origin == "" {
-			// For requests without Origin header, use the configured allowed origin
-			c.Header("Access-Control-Allow-Origin", allowedOrigin)
-		} else {
-			// For other origins, check if they match the allowed origin
-			c.Header("Access-Control-Allow-Origin", allowedOrigin)
-		}
-
-		c.Header("Access-Control-Allow-Credentials", "false")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-		c.Header("Access-Control-Max-Age", "86400") // 24 hours
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
 		c.Next()
 	})
 
+	// Answer preflights and allow the configured origins to read responses
+	router.Use(cors.Middleware(cfg.CORS.Policy()))
+
+	// Identify staff members sending a session token
+	router.Use(authHandlers.authenticate)
+
 	// Define routes
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -94,38 +141,76 @@ func main() {
 	// House routes
 	houses := router.Group("/api/houses")
 	{
-		houses.GET("/", getHouses)
-		houses.GET("/guests", getHousesByGuests)
-		houses.GET("/:id", getHouse)
-		houses.GET("/search/:query", searchHouses)
+		houses.GET("/", houseHandlers.getHouses)
+		houses.GET("/guests", houseHandlers.getHousesByGuests)
+		houses.GET("/:id", houseHandlers.getHouse)
+		houses.GET("/search/:query", houseHandlers.searchHouses)
+	}
+
+	// Guest self-service, guests prove who they are with the digits of their phone number
+	// and a code sent to it
+	guest := router.Group("/api/guest")
+	{
+		guest.GET("/bookings/:ref", guestHandlers.getGuestBooking)
+		guest.POST("/bookings/:ref/code", guestHandlers.sendGuestCode)
+	}
+
+	// Staff sign-in
+	authRoutes := router.Group("/api/auth")
+	{
+		authRoutes.POST("/login", authHandlers.login)
+		authRoutes.GET("/me", cloudflareAccess, anyStaff, authHandlers.me)
+	}
+
+	// Admin routes for the staff accounts
+	adminStaff := router.Group("/api/admin/staff", cloudflareAccess, adminOnly)
+	{
+		adminStaff.GET("/", staffHandlers.getStaff)
+		adminStaff.POST("/", staffHandlers.createStaff)
+		adminStaff.PUT("/:id", staffHandlers.updateStaff)
+		adminStaff.DELETE("/:id", staffHandlers.deleteStaff)
+	}
+
+	// Admin routes for the house catalog
+	adminHouses := router.Group("/api/admin/houses", cloudflareAccess, adminOnly)
+	{
+		adminHouses.POST("/", houseHandlers.createHouse)
+		adminHouses.PUT("/:id", houseHandlers.updateHouse)
+		adminHouses.DELETE("/:id", houseHandlers.deleteHouse)
 	}
 
 	// Booking routes
-	booking := router.Group("/api/bookings")
+	booking := router.Group("/api/bookings", cloudflareAccess, anyStaff)
 	{
-		booking.GET("/", getBookings)
-		booking.GET("/:id", getBooking)
-		booking.POST("/", createBooking)
-		booking.PUT("/:id", updateBooking)
-		booking.DELETE("/:id", deleteBooking)
-		booking.GET("/status/:status", getBookingsByStatus)
-		booking.GET("/user/:user_id", getBookingsByUser)
-		booking.GET("/customer", getBookingsByCustomerInfo)
+		booking.GET("/", bookingHandlers.getBookings)
+		booking.GET("/:id", bookingHandlers.getBooking)
+		booking.POST("/", bookingStaff, idempotency.Middleware(stores.Idempotency, cfg.Server.IdempotencyKeyTTL), bookingHandlers.createBooking)
+		booking.PUT("/:id", bookingStaff, bookingHandlers.updateBooking)
+		booking.PATCH("/:id", bookingStaff, bookingHandlers.patchBooking)
+		booking.DELETE("/:id", adminOnly, bookingHandlers.deleteBooking)
+		booking.POST("/:id/confirm", bookingStaff, bookingHandlers.bookingAction(booking_lifecycle.StatusConfirmed))
+		booking.POST("/:id/pay", bookingStaff, bookingHandlers.bookingAction(booking_lifecycle.StatusPaid))
+		booking.POST("/:id/check-in", bookingStaff, bookingHandlers.bookingAction(booking_lifecycle.StatusCheckedIn))
+		booking.POST("/:id/check-out", bookingStaff, bookingHandlers.bookingAction(booking_lifecycle.StatusCheckedOut))
+		booking.POST("/:id/cancel", bookingStaff, bookingHandlers.bookingAction(booking_lifecycle.StatusCancelled))
+		booking.POST("/:id/no-show", bookingStaff, bookingHandlers.bookingAction(booking_lifecycle.StatusNoShow))
+		booking.GET("/status/:status", bookingHandlers.getBookingsByStatus)
+		booking.GET("/user/:user_id", bookingHandlers.getBookingsByUser)
+		booking.GET("/customer", bookingHandlers.getBookingsByCustomerInfo)
 	}
 
 	// Chatbot routes
 	chat := router.Group("/api/chat")
 	{
-		chat.POST("/message", chatWithAI)
+		chat.POST("/sessions", chatHandlers.createChatSession)
+		chat.GET("/sessions", cloudflareAccess, anyStaff, chatHandlers.getChatSessions) // lists every guest's conversation
+		chat.GET("/sessions/:id", chatHandlers.getChatSession)
+		chat.POST("/message", chatHandlers.chatWithAI)
+		chat.POST("/stream", chatHandlers.streamChatWithAI)
 	}
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("Server starting on port %s", port)
-	log.Printf("Allowed CORS origin: %s", allowedOrigin)
-	router.Run(":" + port)
+	log.Printf("Server starting on port %d", cfg.Server.Port)
+	log.Printf("Allowed CORS origins: %s", strings.Join(cfg.CORS.AllowedOrigins, ", "))
+	router.Run(":" + strconv.Itoa(cfg.Server.Port))
 }
\ No newline at end of file
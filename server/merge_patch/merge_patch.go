@@ -0,0 +1,72 @@
+package merge_patch
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ContentType is the media type of JSON Merge Patch documents, RFC 7396
+const ContentType = "application/merge-patch+json"
+
+// ErrNotObject is returned for a patch that is not a JSON object
+var ErrNotObject = errors.New("merge patch must be a JSON object")
+
+// Apply applies a JSON Merge Patch to a JSON object and returns the patched document.
+// Members of the patch replace those of the document, null members remove them and
+// nested objects are merged the same way.
+func Apply(document, patch []byte) ([]byte, error) {
+	var target map[string]interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	members, ok := changes.(map[string]interface{})
+	if !ok {
+		return nil, ErrNotObject
+	}
+
+	return json.Marshal(merge(target, members))
+}
+
+// Keys returns the top-level members of a patch, null or not, in order
+func Keys(patch []byte) ([]string, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil {
+		return nil, ErrNotObject
+	}
+
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// merge applies the members of a patch to target
+func merge(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			target[key] = value
+			continue
+		}
+		existing, _ := target[key].(map[string]interface{})
+		target[key] = merge(existing, nested)
+	}
+	return target
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Conversation represents a chat session between a guest and the AI assistant
+type Conversation struct {
+	ID           string    `json:"id"`
+	BookingState string    `json:"-"` // JSON encoded booking_flow.State
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ConversationMessage represents a single stored turn of a conversation,
+// including assistant tool calls and tool results
+type ConversationMessage struct {
+	ID             int       `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	Role           string    `json:"role"` // user, assistant, tool
+	Content        string    `json:"content"`
+	Name           string    `json:"name,omitempty"`
+	ToolCalls      string    `json:"tool_calls,omitempty"` // JSON encoded tool calls of an assistant turn
+	ToolCallID     string    `json:"tool_call_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
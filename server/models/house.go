@@ -12,3 +12,10 @@ type House struct {
 	Amenities     []string `json:"amenities"`
 	Guests        int      `json:"guests"`
 }
+
+// AvailableStay is a stay for which at least one house is free
+type AvailableStay struct {
+	CheckIn  string   `json:"check_in"`
+	CheckOut string   `json:"check_out"`
+	Houses   []string `json:"houses"`
+}
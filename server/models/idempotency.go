@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request that must not be repeated
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	StatusCode  int               // 0 while the first request is in progress
+	Headers     map[string]string // response headers replayed with the response
+	Response    string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
@@ -5,15 +5,22 @@ import "time"
 // Booking represents a booking entity with payment information
 type Booking struct {
 	ID           int       `json:"id"`
+	Reference    string    `json:"reference"` // code guests look their booking up with, see booking_ref
 	UserID       int       `json:"user_id"`
+	HouseID      int       `json:"house_id,omitempty"`
 	ResortName   string    `json:"resort_name"`
 	CheckIn      string    `json:"check_in"`
 	CheckOut     string    `json:"check_out"`
 	Guests       int       `json:"guests"`
 	TotalPrice   float64   `json:"total_price"`
-	Status       string    `json:"status"` // pending, confirmed, paid, cancelled
+	Status       string    `json:"status"` // pending, confirmed, paid, checked_in, checked_out, cancelled, no_show
 	PaymentDate  string    `json:"payment_date,omitempty"`
+	CheckedInAt  string    `json:"checked_in_at,omitempty"`
+	CheckedOutAt string    `json:"checked_out_at,omitempty"`
+	CancelledAt  string    `json:"cancelled_at,omitempty"`
 	CustomerName string    `json:"customer_name"`
 	PhoneNumber  string    `json:"phone_number"`
 	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Version      int       `json:"version"` // incremented by every update, see repository.ErrBookingVersionConflict
 }
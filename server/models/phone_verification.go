@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PhoneVerification is a one-time code sent to a phone number. Its scope names what the
+// code unlocks, such as the booking of a chat conversation.
+type PhoneVerification struct {
+	Scope       string
+	PhoneNumber string
+	CodeHash    string
+	Attempts    int // codes entered that were wrong
+	SentAt      time.Time
+	ExpiresAt   time.Time
+	VerifiedAt  *time.Time // set once the code was entered correctly
+}
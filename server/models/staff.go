@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Staff represents an employee account that signs in to manage bookings
+type Staff struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"` // admin, receptionist, read_only
+	CreatedAt    time.Time `json:"created_at"`
+}
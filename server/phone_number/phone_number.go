@@ -0,0 +1,90 @@
+package phone_number
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultCountryCode is the country code of numbers written without one, Indonesia
+const DefaultCountryCode = "62"
+
+// E.164 numbers have at most 15 digits including the country code, shorter ones than
+// minDigits are not reachable phone numbers
+const (
+	minDigits = 8
+	maxDigits = 15
+)
+
+// Indonesian numbers have 8 to 12 digits after the country code
+const (
+	minNationalDigits = 8
+	maxNationalDigits = 12
+)
+
+// InvalidError reports a phone number that cannot be a real phone number
+type InvalidError struct {
+	Number string
+	Reason string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("phone number %q is invalid: %s", e.Number, e.Reason)
+}
+
+// Normalize returns a phone number in E.164 form, such as +628123456789. Spaces, dashes,
+// dots and parentheses are ignored. Numbers without a country code are Indonesian, so
+// "0812-3456-789", "812 3456 789", "62 812 3456 789" and "+62 (0)812 3456 789" are all
+// +628123456789. International numbers start with + or 00. It fails with an
+// *InvalidError when number cannot be a phone number.
+func Normalize(number string) (string, error) {
+	invalid := func(reason string) error {
+		return &InvalidError{Number: number, Reason: reason}
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || strings.ContainsRune("-.()", r) {
+			return -1
+		}
+		return r
+	}, number)
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case strings.HasPrefix(digits, "0"):
+		// The trunk prefix of national numbers
+		digits = DefaultCountryCode + digits[1:]
+	case !strings.HasPrefix(digits, DefaultCountryCode):
+		digits = DefaultCountryCode + digits
+	}
+
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", invalid("it may only hold digits, spaces, dashes, dots, parentheses and a leading +")
+	}
+	if digits[0] == '0' {
+		return "", invalid("country codes do not start with 0")
+	}
+
+	if national, ok := strings.CutPrefix(digits, DefaultCountryCode); ok {
+		// The trunk prefix is often kept after the country code, as in +62 (0)812
+		national = strings.TrimPrefix(national, "0")
+		switch {
+		case len(national) < minNationalDigits:
+			return "", invalid("it is too short for an Indonesian number")
+		case len(national) > maxNationalDigits:
+			return "", invalid("it is too long for an Indonesian number")
+		}
+		digits = DefaultCountryCode + national
+	}
+
+	switch {
+	case len(digits) < minDigits:
+		return "", invalid("it is too short")
+	case len(digits) > maxDigits:
+		return "", invalid(fmt.Sprintf("it has more than %d digits", maxDigits))
+	}
+	return "+" + digits, nil
+}
@@ -0,0 +1,172 @@
+package phone_verification
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"resort-app-server/models"
+	"resort-app-server/repository"
+	"resort-app-server/sms"
+)
+
+// codeLength is the number of digits of a code
+const codeLength = 6
+
+// Config holds the limits of the codes, see config.PhoneVerificationConfig
+type Config struct {
+	CodeTTL        time.Duration // how long a code can be entered
+	MaxAttempts    int           // wrong codes allowed before a new code is needed
+	ResendInterval time.Duration // least time between two codes for the same scope
+}
+
+var (
+	// ErrNoCode is returned when no code was sent to the phone number for the scope
+	ErrNoCode = errors.New("no verification code was sent to this phone number")
+	// ErrCodeExpired is returned for a code entered after it expired
+	ErrCodeExpired = errors.New("the verification code has expired")
+	// ErrTooManyAttempts is returned once the wrong codes used up the attempts of a code
+	ErrTooManyAttempts = errors.New("too many wrong verification codes")
+)
+
+// WrongCodeError reports a code that does not match the code that was sent
+type WrongCodeError struct {
+	AttemptsLeft int
+}
+
+func (e *WrongCodeError) Error() string {
+	return fmt.Sprintf("the verification code is wrong, %d attempts left", e.AttemptsLeft)
+}
+
+// TooSoonError reports a new code requested before the resend interval passed
+type TooSoonError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooSoonError) Error() string {
+	return fmt.Sprintf("a verification code was sent a moment ago, a new one can be sent in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// Verifier sends one-time codes to phone numbers and checks the codes entered. Every code
+// belongs to a scope, which names what it unlocks, such as the booking of a chat
+// conversation. A scope has one code at a time.
+type Verifier struct {
+	store  repository.PhoneVerificationStore
+	sender sms.Sender
+	cfg    Config
+}
+
+// New creates a Verifier that keeps the codes in store and sends them with sender
+func New(store repository.PhoneVerificationStore, sender sms.Sender, cfg Config) *Verifier {
+	return &Verifier{store: store, sender: sender, cfg: cfg}
+}
+
+// CodeTTL returns how long a code can be entered after it was sent
+func (v *Verifier) CodeTTL() time.Duration {
+	return v.cfg.CodeTTL
+}
+
+// Send sends a new code for scope to phone, replacing the earlier code of the scope. It
+// fails with a *TooSoonError while the last code was sent less than the resend interval ago.
+func (v *Verifier) Send(ctx context.Context, scope, phone string) error {
+	now := time.Now()
+	existing, err := v.store.GetPhoneVerification(scope)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if retryAfter := existing.SentAt.Add(v.cfg.ResendInterval).Sub(now); retryAfter > 0 {
+			return &TooSoonError{RetryAfter: retryAfter}
+		}
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	verification := &models.PhoneVerification{
+		Scope:       scope,
+		PhoneNumber: phone,
+		CodeHash:    hashCode(scope, code),
+		SentAt:      now,
+		ExpiresAt:   now.Add(v.cfg.CodeTTL),
+	}
+	if err := v.store.SavePhoneVerification(verification); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your Resort Bot verification code is %s. It expires in %d minutes, do not share it with anyone.", code, int(v.cfg.CodeTTL.Minutes()))
+	if err := v.sender.Send(ctx, phone, message); err != nil {
+		// The code never arrived, the guest may ask for a new one right away
+		v.store.DeletePhoneVerification(scope)
+		return err
+	}
+	return nil
+}
+
+// Check checks a code entered for scope against the code sent to phone. A correct code
+// keeps working until it expires. Every wrong code uses up an attempt, and the errors are
+// ErrNoCode, ErrCodeExpired, ErrTooManyAttempts and *WrongCodeError.
+func (v *Verifier) Check(scope, phone, code string) error {
+	verification, err := v.store.GetPhoneVerification(scope)
+	if err != nil {
+		return err
+	}
+	if verification == nil || verification.PhoneNumber != phone {
+		return ErrNoCode
+	}
+	if !time.Now().Before(verification.ExpiresAt) {
+		return ErrCodeExpired
+	}
+
+	// The attempt is counted before the code is compared, so guesses sent at the same
+	// time cannot get past the limit
+	reserved, err := v.store.ReservePhoneVerificationAttempt(scope, v.cfg.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrTooManyAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(scope, normalizeCode(code))), []byte(verification.CodeHash)) != 1 {
+		attemptsLeft := v.cfg.MaxAttempts - verification.Attempts - 1
+		if attemptsLeft < 0 {
+			attemptsLeft = 0
+		}
+		return &WrongCodeError{AttemptsLeft: attemptsLeft}
+	}
+
+	return v.store.MarkPhoneVerified(scope, time.Now())
+}
+
+// newCode returns a random code of codeLength digits
+func newCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < codeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeLength, n), nil
+}
+
+// hashCode returns the stored form of a code, codes are not kept in plain text
+func hashCode(scope, code string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeCode removes the spaces and dashes a guest may type within a code
+func normalizeCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+}
@@ -0,0 +1,90 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"resort-app-server/models"
+	"resort-app-server/repository"
+)
+
+// DateLayout is the format of stay dates
+const DateLayout = "2006-01-02"
+
+// Quote is the price of a stay in one house
+type Quote struct {
+	HouseID       int     `json:"house_id"`
+	HouseName     string  `json:"house_name"`
+	CheckIn       string  `json:"check_in"`
+	CheckOut      string  `json:"check_out"`
+	Nights        int     `json:"nights"`
+	PricePerNight float64 `json:"price_per_night"`
+	TotalPrice    float64 `json:"total_price"`
+}
+
+// UnknownHouseError reports a quote requested for a house that is not in the catalog
+type UnknownHouseError struct {
+	Name string
+}
+
+func (e *UnknownHouseError) Error() string {
+	return fmt.Sprintf("unknown house: %s", e.Name)
+}
+
+// Nights returns the number of nights between checkIn and checkOut.
+// An empty checkOut is a single night.
+func Nights(checkIn, checkOut string) (int, error) {
+	start, err := time.Parse(DateLayout, checkIn)
+	if err != nil {
+		return 0, fmt.Errorf("invalid check-in date format: %s", checkIn)
+	}
+	if checkOut == "" {
+		return 1, nil
+	}
+
+	end, err := time.Parse(DateLayout, checkOut)
+	if err != nil {
+		return 0, fmt.Errorf("invalid check-out date format: %s", checkOut)
+	}
+	if !end.After(start) {
+		return 0, fmt.Errorf("check-out date %s must be after the check-in date %s", checkOut, checkIn)
+	}
+
+	return int(end.Sub(start).Hours() / 24), nil
+}
+
+// QuoteStay prices a stay in house from checkIn until checkOut
+func QuoteStay(house *models.House, checkIn, checkOut string) (*Quote, error) {
+	nights, err := Nights(checkIn, checkOut)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkOut == "" {
+		start, _ := time.Parse(DateLayout, checkIn)
+		checkOut = start.AddDate(0, 0, nights).Format(DateLayout)
+	}
+
+	return &Quote{
+		HouseID:       house.ID,
+		HouseName:     house.Name,
+		CheckIn:       checkIn,
+		CheckOut:      checkOut,
+		Nights:        nights,
+		PricePerNight: house.PricePerNight,
+		TotalPrice:    house.PricePerNight * float64(nights),
+	}, nil
+}
+
+// QuoteByHouseName prices a stay in the house of the catalog with the given name, ignoring case
+func QuoteByHouseName(houses repository.HouseStore, houseName, checkIn, checkOut string) (*Quote, error) {
+	house, err := houses.GetHouseByName(houseName)
+	if err != nil {
+		return nil, err
+	}
+	if house == nil {
+		return nil, &UnknownHouseError{Name: houseName}
+	}
+
+	return QuoteStay(house, checkIn, checkOut)
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"resort-app-server/models"
+	"time"
+)
+
+// AvailableHouses returns houses that can accommodate at least the specified number of guests
+// and are not booked between checkIn and checkOut (YYYY-MM-DD, check-out exclusive).
+// An empty checkIn skips the availability check.
+func (s *Stores) AvailableHouses(guests int, checkIn, checkOut string) ([]models.House, error) {
+	houses, err := s.Houses.GetHousesByGuests(guests)
+	if err != nil {
+		return nil, err
+	}
+
+	booked := map[int]bool{}
+	if checkIn != "" {
+		booked, err = s.Bookings.GetBookedHouseIDs(checkIn, checkOut)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filteredHouses []models.House
+	for _, house := range houses {
+		if !booked[house.ID] {
+			filteredHouses = append(filteredHouses, house)
+		}
+	}
+
+	return filteredHouses, nil
+}
+
+// IsHouseAvailable reports whether a house has no booking between checkIn and checkOut
+func (s *Stores) IsHouseAvailable(houseID int, checkIn, checkOut string) (bool, error) {
+	booked, err := s.Bookings.GetBookedHouseIDs(checkIn, checkOut)
+	if err != nil {
+		return false, err
+	}
+	return !booked[houseID], nil
+}
+
+// FindNearestAvailableDates looks for stays of the same length as checkIn-checkOut,
+// closest to checkIn first, where at least one house fits the guests.
+// No stay starts before earliest, and at most limit stays within maxShiftDays are returned.
+func (s *Stores) FindNearestAvailableDates(guests int, checkIn, checkOut, earliest string, maxShiftDays, limit int) ([]models.AvailableStay, error) {
+	start, err := time.Parse(DateLayout, checkIn)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse(DateLayout, checkOut)
+	if err != nil {
+		return nil, err
+	}
+	nights := int(end.Sub(start).Hours() / 24)
+
+	candidates, err := s.Houses.GetHousesByGuests(guests)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// Load every booking in the searched window once instead of querying each date
+	windowStart := start.AddDate(0, 0, -maxShiftDays).Format(DateLayout)
+	windowEnd := end.AddDate(0, 0, maxShiftDays).Format(DateLayout)
+	bookings, err := s.Bookings.GetActiveBookingsBetween(windowStart, windowEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var stays []models.AvailableStay
+	for shift := 1; shift <= maxShiftDays && len(stays) < limit; shift++ {
+		for _, direction := range []int{-1, 1} {
+			stayStart := start.AddDate(0, 0, direction*shift)
+			stayIn := stayStart.Format(DateLayout)
+			if stayIn < earliest {
+				continue
+			}
+			stayOut := stayStart.AddDate(0, 0, nights).Format(DateLayout)
+
+			var free []string
+			for _, house := range candidates {
+				if !isBooked(bookings, house.ID, stayIn, stayOut) {
+					free = append(free, house.Name)
+				}
+			}
+			if len(free) > 0 && len(stays) < limit {
+				stays = append(stays, models.AvailableStay{CheckIn: stayIn, CheckOut: stayOut, Houses: free})
+			}
+		}
+	}
+
+	return stays, nil
+}
+
+// isBooked reports whether one of the bookings occupies the house between checkIn and checkOut
+func isBooked(bookings []models.Booking, houseID int, checkIn, checkOut string) bool {
+	for _, booking := range bookings {
+		if booking.HouseID == houseID && booking.CheckIn < checkOut && booking.CheckOut > checkIn {
+			return true
+		}
+	}
+	return false
+}
@@ -2,14 +2,54 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"log"
+	"resort-app-server/booking_lifecycle"
+	"resort-app-server/booking_ref"
 	"resort-app-server/database"
 	"resort-app-server/models"
+	"time"
 )
 
-// GetAllBookings retrieves all bookings from the database
-func GetAllBookings() ([]models.Booking, error) {
-	rows, err := database.DB.Query("SELECT id, user_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, customer_name, phone_number, created_at FROM bookings")
+// activeBooking selects the bookings that still hold their house, see booking_lifecycle.IsActive
+const activeBooking = "status NOT IN ('cancelled', 'no_show')"
+
+// bookingColumns are the columns read by scanBooking, in order
+const bookingColumns = "id, reference, user_id, house_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, checked_in_at, checked_out_at, cancelled_at, customer_name, phone_number, created_at, updated_at, version"
+
+// scanBooking reads a row selected with bookingColumns
+func scanBooking(row rowScanner) (*models.Booking, error) {
+	var booking models.Booking
+	var checkIn, checkOut, paymentDate, checkedInAt, checkedOutAt, cancelledAt interface{}
+	var houseID sql.NullInt64
+	var reference, customerName, phoneNumber sql.NullString
+	var updatedAt sql.NullTime
+	err := row.Scan(&booking.ID, &reference, &booking.UserID, &houseID, &booking.ResortName, &checkIn, &checkOut, &booking.Guests, &booking.TotalPrice, &booking.Status,
+		&paymentDate, &checkedInAt, &checkedOutAt, &cancelledAt, &customerName, &phoneNumber, &booking.CreatedAt, &updatedAt, &booking.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	booking.CheckIn = formatDate(checkIn, DateLayout)
+	booking.CheckOut = formatDate(checkOut, DateLayout)
+	booking.PaymentDate = formatDate(paymentDate, DateLayout)
+	booking.CheckedInAt = formatDate(checkedInAt, time.RFC3339)
+	booking.CheckedOutAt = formatDate(checkedOutAt, time.RFC3339)
+	booking.CancelledAt = formatDate(cancelledAt, time.RFC3339)
+
+	// Handle NULL values
+	booking.Reference = reference.String
+	booking.HouseID = int(houseID.Int64)
+	booking.CustomerName = customerName.String
+	booking.PhoneNumber = phoneNumber.String
+	booking.UpdatedAt = updatedAt.Time
+
+	return &booking, nil
+}
+
+// queryBookings retrieves the bookings selected by a query on bookingColumns
+func (s *sqlStore) queryBookings(query string, args ...interface{}) ([]models.Booking, error) {
+	rows, err := s.conn().query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -17,33 +57,25 @@ func GetAllBookings() ([]models.Booking, error) {
 
 	var bookings []models.Booking
 	for rows.Next() {
-		var booking models.Booking
-		var customerName, phoneNumber sql.NullString
-		err := rows.Scan(&booking.ID, &booking.UserID, &booking.ResortName, &booking.CheckIn, &booking.CheckOut, &booking.Guests, &booking.TotalPrice, &booking.Status, &booking.PaymentDate, &customerName, &phoneNumber, &booking.CreatedAt)
+		booking, err := scanBooking(rows)
 		if err != nil {
 			log.Println("Error scanning booking row:", err)
 			continue
 		}
-		// Handle NULL values
-		if customerName.Valid {
-			booking.CustomerName = customerName.String
-		}
-		if phoneNumber.Valid {
-			booking.PhoneNumber = phoneNumber.String
-		}
-		bookings = append(bookings, booking)
+		bookings = append(bookings, *booking)
 	}
 
 	return bookings, nil
 }
 
-// GetBookingByID retrieves a booking by its ID
-func GetBookingByID(id int) (*models.Booking, error) {
-	var booking models.Booking
-	var customerName, phoneNumber sql.NullString
-	err := database.DB.QueryRow("SELECT id, user_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, customer_name, phone_number, created_at FROM bookings WHERE id = ?", id).
-		Scan(&booking.ID, &booking.UserID, &booking.ResortName, &booking.CheckIn, &booking.CheckOut, &booking.Guests, &booking.TotalPrice, &booking.Status, &booking.PaymentDate, &customerName, &phoneNumber, &booking.CreatedAt)
+// GetAllBookings retrieves all bookings from the database
+func (s *sqlStore) GetAllBookings() ([]models.Booking, error) {
+	return s.queryBookings("SELECT " + bookingColumns + " FROM bookings ORDER BY id")
+}
 
+// GetBookingByID retrieves a booking by its ID
+func (s *sqlStore) GetBookingByID(id int) (*models.Booking, error) {
+	booking, err := scanBooking(s.conn().queryRow("SELECT "+bookingColumns+" FROM bookings WHERE id = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -51,84 +83,196 @@ func GetBookingByID(id int) (*models.Booking, error) {
 		return nil, err
 	}
 
-	// Handle NULL values
-	if customerName.Valid {
-		booking.CustomerName = customerName.String
-	}
-	if phoneNumber.Valid {
-		booking.PhoneNumber = phoneNumber.String
+	return booking, nil
+}
+
+// GetBookingByReference retrieves a booking by its reference code, in the form returned by
+// booking_ref.Normalize
+func (s *sqlStore) GetBookingByReference(reference string) (*models.Booking, error) {
+	booking, err := scanBooking(s.conn().queryRow("SELECT "+bookingColumns+" FROM bookings WHERE reference = ?", reference))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	return &booking, nil
+	return booking, nil
 }
 
-// CreateBooking inserts a new booking into the database
-func CreateBooking(booking *models.Booking) error {
-	result, err := database.DB.Exec(
-		"INSERT INTO bookings (user_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, customer_name, phone_number) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		booking.UserID, booking.ResortName, booking.CheckIn, booking.CheckOut, booking.Guests, booking.TotalPrice, booking.Status, booking.PaymentDate, booking.CustomerName, booking.PhoneNumber)
+// maxReferenceAttempts bounds the search for an unused reference code, a collision is
+// already very unlikely
+const maxReferenceAttempts = 5
 
+// newBookingReference returns a reference code that no booking uses yet
+func newBookingReference(conn sqlConn) (string, error) {
+	for attempt := 0; attempt < maxReferenceAttempts; attempt++ {
+		reference, err := booking_ref.New()
+		if err != nil {
+			return "", err
+		}
+
+		var exists int
+		err = conn.queryRow("SELECT 1 FROM bookings WHERE reference = ?", reference).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return reference, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("no unused booking reference found")
+}
+
+// checkOverlap fails with a *BookingConflictError when another active booking holds the
+// same house during the stay. It runs inside the transaction that writes the booking.
+func (s *sqlStore) checkOverlap(tx sqlConn, booking *models.Booking) error {
+	if !booking_lifecycle.IsActive(booking.Status) {
+		return nil
+	}
+
+	checkOut, err := stayCheckOut(booking.CheckIn, booking.CheckOut)
 	if err != nil {
 		return err
 	}
 
-	id, err := result.LastInsertId()
+	// SQLite transactions take the write lock when they begin. On Postgres booking
+	// writes are serialized explicitly, reads of the table are not blocked.
+	if s.db.Driver == database.Postgres {
+		if _, err := tx.exec("LOCK TABLE bookings IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+	}
+
+	// Bookings of houses outside the catalog are matched by name
+	var conflictingID int
+	err = tx.queryRow(
+		"SELECT id FROM bookings WHERE "+activeBooking+" AND id != ? AND (house_id = ? OR (house_id IS NULL AND lower(resort_name) = lower(?))) AND check_in < ? AND check_out > ? LIMIT 1",
+		booking.ID, houseIDValue(booking.HouseID), booking.ResortName, checkOut, booking.CheckIn).Scan(&conflictingID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	booking.ID = int(id)
-	return nil
+	return &BookingConflictError{HouseName: booking.ResortName, CheckIn: booking.CheckIn, CheckOut: checkOut, ConflictingID: conflictingID}
 }
 
-// UpdateBooking updates an existing booking in the database
-func UpdateBooking(booking *models.Booking) error {
-	_, err := database.DB.Exec(
-		"UPDATE bookings SET user_id = ?, resort_name = ?, check_in = ?, check_out = ?, guests = ?, total_price = ?, status = ?, payment_date = ?, customer_name = ?, phone_number = ? WHERE id = ?",
-		booking.UserID, booking.ResortName, booking.CheckIn, booking.CheckOut, booking.Guests, booking.TotalPrice, booking.Status, booking.PaymentDate, booking.CustomerName, booking.PhoneNumber, booking.ID)
+// CreateBooking inserts a new booking into the database at version 1 and gives it a new
+// reference code. It fails with a *BookingConflictError when the house is already booked for the stay.
+func (s *sqlStore) CreateBooking(booking *models.Booking) error {
+	if err := normalizeBookingPhone(booking); err != nil {
+		return err
+	}
+
+	return s.inTx(func(tx sqlConn) error {
+		if err := s.checkOverlap(tx, booking); err != nil {
+			return err
+		}
 
-	return err
+		reference, err := newBookingReference(tx)
+		if err != nil {
+			return err
+		}
+		booking.Reference = reference
+
+		return tx.queryRow(
+			"INSERT INTO bookings (reference, user_id, house_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, checked_in_at, checked_out_at, cancelled_at, customer_name, phone_number, updated_at, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, 1) RETURNING id, created_at, updated_at, version",
+			booking.Reference, booking.UserID, houseIDValue(booking.HouseID), booking.ResortName, booking.CheckIn, booking.CheckOut, booking.Guests, booking.TotalPrice, booking.Status, nullIfEmpty(booking.PaymentDate),
+			nullIfEmpty(booking.CheckedInAt), nullIfEmpty(booking.CheckedOutAt), nullIfEmpty(booking.CancelledAt), booking.CustomerName, booking.PhoneNumber).
+			Scan(&booking.ID, &booking.CreatedAt, &booking.UpdatedAt, &booking.Version)
+	})
+}
+
+// UpdateBooking updates an existing booking in the database and increments its version.
+// booking.Version must be the version that was read, otherwise the booking has changed in
+// the meantime and ErrBookingVersionConflict is returned. It fails with a
+// *BookingConflictError when the house is already booked for the stay.
+func (s *sqlStore) UpdateBooking(booking *models.Booking) error {
+	return s.inTx(func(tx sqlConn) error {
+		if err := normalizeBookingPhone(booking); err != nil {
+			// A number saved before numbers were checked may stay while it does not change
+			var stored sql.NullString
+			if tx.queryRow("SELECT phone_number FROM bookings WHERE id = ?", booking.ID).Scan(&stored) != nil || stored.String != booking.PhoneNumber {
+				return err
+			}
+		}
+
+		if err := s.checkOverlap(tx, booking); err != nil {
+			return err
+		}
+
+		err := tx.queryRow(
+			"UPDATE bookings SET user_id = ?, house_id = ?, resort_name = ?, check_in = ?, check_out = ?, guests = ?, total_price = ?, status = ?, payment_date = ?, checked_in_at = ?, checked_out_at = ?, cancelled_at = ?, customer_name = ?, phone_number = ?, "+
+				"updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND version = ? RETURNING updated_at, version",
+			booking.UserID, houseIDValue(booking.HouseID), booking.ResortName, booking.CheckIn, booking.CheckOut, booking.Guests, booking.TotalPrice, booking.Status, nullIfEmpty(booking.PaymentDate),
+			nullIfEmpty(booking.CheckedInAt), nullIfEmpty(booking.CheckedOutAt), nullIfEmpty(booking.CancelledAt), booking.CustomerName, booking.PhoneNumber, booking.ID, booking.Version).
+			Scan(&booking.UpdatedAt, &booking.Version)
+		if err == sql.ErrNoRows {
+			return ErrBookingVersionConflict
+		}
+		return err
+	})
 }
 
 // DeleteBooking removes a booking from the database
-func DeleteBooking(id int) error {
-	_, err := database.DB.Exec("DELETE FROM bookings WHERE id = ?", id)
+func (s *sqlStore) DeleteBooking(id int) error {
+	_, err := s.conn().exec("DELETE FROM bookings WHERE id = ?", id)
 	return err
 }
 
 // GetBookingsByStatus retrieves bookings by their status
-func GetBookingsByStatus(status string) ([]models.Booking, error) {
-	rows, err := database.DB.Query("SELECT id, user_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, customer_name, phone_number, created_at FROM bookings WHERE status = ?", status)
+func (s *sqlStore) GetBookingsByStatus(status string) ([]models.Booking, error) {
+	return s.queryBookings("SELECT "+bookingColumns+" FROM bookings WHERE status = ? ORDER BY id", status)
+}
+
+// GetBookingsByUserID retrieves bookings by user ID
+func (s *sqlStore) GetBookingsByUserID(userID int) ([]models.Booking, error) {
+	return s.queryBookings("SELECT "+bookingColumns+" FROM bookings WHERE user_id = ? ORDER BY id", userID)
+}
+
+// GetBookingsByCustomerInfo retrieves bookings by customer name and phone number
+// This is used for anonymous booking systems where customers don't have accounts
+func (s *sqlStore) GetBookingsByCustomerInfo(name, phone string) ([]models.Booking, error) {
+	return s.queryBookings("SELECT "+bookingColumns+" FROM bookings WHERE customer_name = ? AND phone_number = ? ORDER BY id", name, lookupPhone(phone))
+}
+
+// GetBookedHouseIDs returns the IDs of the houses with an active booking overlapping
+// checkIn-checkOut. The check-out day is free for the next guest, an empty checkOut
+// means a single night.
+func (s *sqlStore) GetBookedHouseIDs(checkIn, checkOut string) (map[int]bool, error) {
+	checkOut, err := stayCheckOut(checkIn, checkOut)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn().query(
+		"SELECT DISTINCT house_id FROM bookings WHERE house_id IS NOT NULL AND "+activeBooking+" AND check_in < ? AND check_out > ?",
+		checkOut, checkIn)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var bookings []models.Booking
+	booked := make(map[int]bool)
 	for rows.Next() {
-		var booking models.Booking
-		var customerName, phoneNumber sql.NullString
-		err := rows.Scan(&booking.ID, &booking.UserID, &booking.ResortName, &booking.CheckIn, &booking.CheckOut, &booking.Guests, &booking.TotalPrice, &booking.Status, &booking.PaymentDate, &customerName, &phoneNumber, &booking.CreatedAt)
-		if err != nil {
-			log.Println("Error scanning booking row:", err)
-			continue
-		}
-		// Handle NULL values
-		if customerName.Valid {
-			booking.CustomerName = customerName.String
-		}
-		if phoneNumber.Valid {
-			booking.PhoneNumber = phoneNumber.String
+		var houseID int
+		if err := rows.Scan(&houseID); err != nil {
+			return nil, err
 		}
-		bookings = append(bookings, booking)
+		booked[houseID] = true
 	}
 
-	return bookings, nil
+	return booked, rows.Err()
 }
 
-// GetBookingsByUserID retrieves bookings by user ID
-func GetBookingsByUserID(userID int) ([]models.Booking, error) {
-	rows, err := database.DB.Query("SELECT id, user_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, customer_name, phone_number, created_at FROM bookings WHERE user_id = ?", userID)
+// GetActiveBookingsBetween retrieves the active bookings of catalog houses overlapping from-to.
+// Only the house and dates are loaded.
+func (s *sqlStore) GetActiveBookingsBetween(from, to string) ([]models.Booking, error) {
+	rows, err := s.conn().query(
+		"SELECT id, house_id, resort_name, check_in, check_out FROM bookings WHERE house_id IS NOT NULL AND "+activeBooking+" AND check_in < ? AND check_out > ?",
+		to, from)
 	if err != nil {
 		return nil, err
 	}
@@ -137,52 +281,68 @@ func GetBookingsByUserID(userID int) ([]models.Booking, error) {
 	var bookings []models.Booking
 	for rows.Next() {
 		var booking models.Booking
-		var customerName, phoneNumber sql.NullString
-		err := rows.Scan(&booking.ID, &booking.UserID, &booking.ResortName, &booking.CheckIn, &booking.CheckOut, &booking.Guests, &booking.TotalPrice, &booking.Status, &booking.PaymentDate, &customerName, &phoneNumber, &booking.CreatedAt)
-		if err != nil {
-			log.Println("Error scanning booking row:", err)
-			continue
-		}
-		// Handle NULL values
-		if customerName.Valid {
-			booking.CustomerName = customerName.String
-		}
-		if phoneNumber.Valid {
-			booking.PhoneNumber = phoneNumber.String
+		var checkIn, checkOut interface{}
+		if err := rows.Scan(&booking.ID, &booking.HouseID, &booking.ResortName, &checkIn, &checkOut); err != nil {
+			return nil, err
 		}
+		booking.CheckIn = formatDate(checkIn, DateLayout)
+		booking.CheckOut = formatDate(checkOut, DateLayout)
 		bookings = append(bookings, booking)
 	}
 
-	return bookings, nil
+	return bookings, rows.Err()
 }
 
-// GetBookingsByCustomerInfo retrieves bookings by customer name and phone number
-// This is used for anonymous booking systems where customers don't have accounts
-func GetBookingsByCustomerInfo(name, phone string) ([]models.Booking, error) {
-	rows, err := database.DB.Query("SELECT id, user_id, resort_name, check_in, check_out, guests, total_price, status, payment_date, customer_name, phone_number, created_at FROM bookings WHERE customer_name = ? AND phone_number = ?", name, phone)
+// BackfillBookingHouses links the bookings made before house_id existed to the house with
+// the same name. Bookings whose name is not a house stay unlinked.
+func (s *sqlStore) BackfillBookingHouses() error {
+	result, err := s.conn().exec("UPDATE bookings SET house_id = (SELECT id FROM houses WHERE lower(houses.name) = lower(bookings.resort_name)) WHERE house_id IS NULL")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	if linked, _ := result.RowsAffected(); linked > 0 {
+		var unlinked int
+		if err := s.conn().queryRow("SELECT COUNT(*) FROM bookings WHERE house_id IS NULL").Scan(&unlinked); err != nil {
+			return err
+		}
+		log.Printf("Linked existing bookings to houses, %d bookings do not match a house", unlinked)
+	}
+	return nil
+}
 
-	var bookings []models.Booking
-	for rows.Next() {
-		var booking models.Booking
-		var customerName, phoneNumber sql.NullString
-		err := rows.Scan(&booking.ID, &booking.UserID, &booking.ResortName, &booking.CheckIn, &booking.CheckOut, &booking.Guests, &booking.TotalPrice, &booking.Status, &booking.PaymentDate, &customerName, &phoneNumber, &booking.CreatedAt)
+// BackfillBookingReferences gives the bookings made before reference codes existed a code
+func (s *sqlStore) BackfillBookingReferences() error {
+	return s.inTx(func(tx sqlConn) error {
+		rows, err := tx.query("SELECT id FROM bookings WHERE reference IS NULL ORDER BY id")
 		if err != nil {
-			log.Println("Error scanning booking row:", err)
-			continue
+			return err
 		}
-		// Handle NULL values
-		if customerName.Valid {
-			booking.CustomerName = customerName.String
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
 		}
-		if phoneNumber.Valid {
-			booking.PhoneNumber = phoneNumber.String
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
 		}
-		bookings = append(bookings, booking)
-	}
 
-	return bookings, nil
-}
\ No newline at end of file
+		for _, id := range ids {
+			reference, err := newBookingReference(tx)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.exec("UPDATE bookings SET reference = ? WHERE id = ?", reference, id); err != nil {
+				return err
+			}
+		}
+		if len(ids) > 0 {
+			log.Printf("Gave %d existing bookings a reference code", len(ids))
+		}
+		return nil
+	})
+}
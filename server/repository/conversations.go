@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"resort-app-server/models"
+)
+
+// CreateConversation starts a new chat session with a random, non-guessable ID
+func (s *sqlStore) CreateConversation() (*models.Conversation, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+
+	_, err := s.conn().exec("INSERT INTO conversations (id) VALUES (?)", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetConversationByID(id)
+}
+
+// GetConversationByID retrieves a conversation by its ID
+func (s *sqlStore) GetConversationByID(id string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	var bookingState sql.NullString
+	err := s.conn().queryRow("SELECT id, booking_state, created_at, updated_at FROM conversations WHERE id = ?", id).
+		Scan(&conversation.ID, &bookingState, &conversation.CreatedAt, &conversation.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Handle NULL values
+	if bookingState.Valid {
+		conversation.BookingState = bookingState.String
+	}
+
+	return &conversation, nil
+}
+
+// GetAllConversations retrieves all conversations, most recently active first
+func (s *sqlStore) GetAllConversations() ([]models.Conversation, error) {
+	rows, err := s.conn().query("SELECT id, booking_state, created_at, updated_at FROM conversations ORDER BY updated_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		var conversation models.Conversation
+		var bookingState sql.NullString
+		err := rows.Scan(&conversation.ID, &bookingState, &conversation.CreatedAt, &conversation.UpdatedAt)
+		if err != nil {
+			log.Println("Error scanning conversation row:", err)
+			continue
+		}
+		// Handle NULL values
+		if bookingState.Valid {
+			conversation.BookingState = bookingState.String
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	return conversations, nil
+}
+
+// UpdateConversationBookingState stores the booking dialogue state of a conversation
+func (s *sqlStore) UpdateConversationBookingState(id, bookingState string) error {
+	_, err := s.conn().exec("UPDATE conversations SET booking_state = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", bookingState, id)
+	return err
+}
+
+// AddConversationMessage appends a message to a conversation
+func (s *sqlStore) AddConversationMessage(message *models.ConversationMessage) error {
+	err := s.conn().queryRow(
+		"INSERT INTO messages (conversation_id, role, content, name, tool_calls, tool_call_id) VALUES (?, ?, ?, ?, ?, ?) RETURNING id, created_at",
+		message.ConversationID, message.Role, message.Content, message.Name, message.ToolCalls, message.ToolCallID).Scan(&message.ID, &message.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn().exec("UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", message.ConversationID)
+	return err
+}
+
+// GetConversationMessages retrieves the messages of a conversation in the order they were added
+func (s *sqlStore) GetConversationMessages(conversationID string) ([]models.ConversationMessage, error) {
+	rows, err := s.conn().query("SELECT id, conversation_id, role, content, name, tool_calls, tool_call_id, created_at FROM messages WHERE conversation_id = ? ORDER BY id", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.ConversationMessage
+	for rows.Next() {
+		var message models.ConversationMessage
+		var name, toolCalls, toolCallID sql.NullString
+		err := rows.Scan(&message.ID, &message.ConversationID, &message.Role, &message.Content, &name, &toolCalls, &toolCallID, &message.CreatedAt)
+		if err != nil {
+			// A missing turn would corrupt the context sent to the model
+			return nil, err
+		}
+		// Handle NULL values
+		if name.Valid {
+			message.Name = name.String
+		}
+		if toolCalls.Valid {
+			message.ToolCalls = toolCalls.String
+		}
+		if toolCallID.Valid {
+			message.ToolCallID = toolCallID.String
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
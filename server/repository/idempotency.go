@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"resort-app-server/models"
+)
+
+// ReserveIdempotencyKey records that the first request with key has started. When the
+// key is already recorded, nothing is written and the record is returned. Expired keys
+// are removed first, so they can be used again.
+func (s *sqlStore) ReserveIdempotencyKey(key, requestHash string, expiresAt time.Time) (*models.IdempotencyRecord, error) {
+	var existing *models.IdempotencyRecord
+	err := s.inTx(func(tx sqlConn) error {
+		if _, err := tx.exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", time.Now().UTC()); err != nil {
+			return err
+		}
+
+		result, err := tx.exec("INSERT INTO idempotency_keys (idempotency_key, request_hash, expires_at) VALUES (?, ?, ?) ON CONFLICT (idempotency_key) DO NOTHING",
+			key, requestHash, expiresAt.UTC())
+		if err != nil {
+			return err
+		}
+		if inserted, err := result.RowsAffected(); err != nil || inserted > 0 {
+			return err
+		}
+
+		var record models.IdempotencyRecord
+		var headers string
+		err = tx.queryRow("SELECT idempotency_key, request_hash, status_code, response_headers, response, created_at, expires_at FROM idempotency_keys WHERE idempotency_key = ?", key).
+			Scan(&record.Key, &record.RequestHash, &record.StatusCode, &headers, &record.Response, &record.CreatedAt, &record.ExpiresAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if headers != "" {
+			if err := json.Unmarshal([]byte(headers), &record.Headers); err != nil {
+				return err
+			}
+		}
+		existing = &record
+		return nil
+	})
+	return existing, err
+}
+
+// CompleteIdempotencyKey stores the outcome of the request with key
+func (s *sqlStore) CompleteIdempotencyKey(key string, statusCode int, headers map[string]string, response string) error {
+	var encodedHeaders []byte
+	if len(headers) > 0 {
+		var err error
+		if encodedHeaders, err = json.Marshal(headers); err != nil {
+			return err
+		}
+	}
+	_, err := s.conn().exec("UPDATE idempotency_keys SET status_code = ?, response_headers = ?, response = ? WHERE idempotency_key = ?", statusCode, string(encodedHeaders), response, key)
+	return err
+}
+
+// ReleaseIdempotencyKey removes a key whose request failed, so it can be retried
+func (s *sqlStore) ReleaseIdempotencyKey(key string) error {
+	_, err := s.conn().exec("DELETE FROM idempotency_keys WHERE idempotency_key = ?", key)
+	return err
+}
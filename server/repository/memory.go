@@ -0,0 +1,661 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"resort-app-server/booking_lifecycle"
+	"resort-app-server/booking_ref"
+	"resort-app-server/models"
+)
+
+// memoryStore implements the stores in memory. It behaves like the SQL stores, including
+// the overlap check of bookings, so it can stand in for them in tests.
+type memoryStore struct {
+	mu            sync.Mutex
+	houses        map[int]models.House
+	bookings      map[int]models.Booking
+	conversations map[string]models.Conversation
+	messages      map[string][]models.ConversationMessage
+	staff         map[int]models.Staff
+	idempotency   map[string]models.IdempotencyRecord
+	verifications map[string]models.PhoneVerification
+	lastHouseID   int
+	lastBookingID int
+	lastMessageID int
+	lastStaffID   int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		houses:        make(map[int]models.House),
+		bookings:      make(map[int]models.Booking),
+		conversations: make(map[string]models.Conversation),
+		messages:      make(map[string][]models.ConversationMessage),
+		staff:         make(map[int]models.Staff),
+		idempotency:   make(map[string]models.IdempotencyRecord),
+		verifications: make(map[string]models.PhoneVerification),
+	}
+}
+
+// copyHouse returns a house that does not share its amenities with the stored one
+func copyHouse(house models.House) models.House {
+	house.Amenities = append([]string{}, house.Amenities...)
+	return house
+}
+
+// filterBookings returns the bookings matching keep, ordered by ID
+func (m *memoryStore) filterBookings(keep func(models.Booking) bool) []models.Booking {
+	var bookings []models.Booking
+	for _, booking := range m.bookings {
+		if keep(booking) {
+			bookings = append(bookings, booking)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].ID < bookings[j].ID })
+	return bookings
+}
+
+// filterHouses returns the houses matching keep, ordered by ID
+func (m *memoryStore) filterHouses(keep func(models.House) bool) []models.House {
+	var houses []models.House
+	for _, house := range m.houses {
+		if keep(house) {
+			houses = append(houses, copyHouse(house))
+		}
+	}
+	sort.Slice(houses, func(i, j int) bool { return houses[i].ID < houses[j].ID })
+	return houses
+}
+
+// GetAllBookings returns every booking
+func (m *memoryStore) GetAllBookings() ([]models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBookings(func(models.Booking) bool { return true }), nil
+}
+
+// GetBookingByID returns a booking by its ID
+func (m *memoryStore) GetBookingByID(id int) (*models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	booking, ok := m.bookings[id]
+	if !ok {
+		return nil, nil
+	}
+	return &booking, nil
+}
+
+// GetBookingByReference returns the booking with a reference code
+func (m *memoryStore) GetBookingByReference(reference string) (*models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, booking := range m.bookings {
+		if booking.Reference == reference {
+			return &booking, nil
+		}
+	}
+	return nil, nil
+}
+
+// newBookingReference returns a reference code that no booking uses yet
+func (m *memoryStore) newBookingReference() (string, error) {
+	for attempt := 0; attempt < maxReferenceAttempts; attempt++ {
+		reference, err := booking_ref.New()
+		if err != nil {
+			return "", err
+		}
+		unused := true
+		for _, booking := range m.bookings {
+			if booking.Reference == reference {
+				unused = false
+				break
+			}
+		}
+		if unused {
+			return reference, nil
+		}
+	}
+	return "", errors.New("no unused booking reference found")
+}
+
+// GetBookingsByStatus returns the bookings with a status
+func (m *memoryStore) GetBookingsByStatus(status string) ([]models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBookings(func(b models.Booking) bool { return b.Status == status }), nil
+}
+
+// GetBookingsByUserID returns the bookings of a user
+func (m *memoryStore) GetBookingsByUserID(userID int) ([]models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBookings(func(b models.Booking) bool { return b.UserID == userID }), nil
+}
+
+// GetBookingsByCustomerInfo returns the bookings with a customer name and phone number
+func (m *memoryStore) GetBookingsByCustomerInfo(name, phone string) ([]models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	phone = lookupPhone(phone)
+	return m.filterBookings(func(b models.Booking) bool { return b.CustomerName == name && b.PhoneNumber == phone }), nil
+}
+
+// checkOverlap fails with a *BookingConflictError when another active booking holds the same house
+func (m *memoryStore) checkOverlap(booking *models.Booking) error {
+	if !booking_lifecycle.IsActive(booking.Status) {
+		return nil
+	}
+
+	checkOut, err := stayCheckOut(booking.CheckIn, booking.CheckOut)
+	if err != nil {
+		return err
+	}
+
+	conflicts := m.filterBookings(func(other models.Booking) bool {
+		sameHouse := (booking.HouseID != 0 && other.HouseID == booking.HouseID) ||
+			(other.HouseID == 0 && strings.EqualFold(other.ResortName, booking.ResortName))
+		return other.ID != booking.ID && sameHouse && booking_lifecycle.IsActive(other.Status) &&
+			other.CheckIn < checkOut && other.CheckOut > booking.CheckIn
+	})
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	return &BookingConflictError{HouseName: booking.ResortName, CheckIn: booking.CheckIn, CheckOut: checkOut, ConflictingID: conflicts[0].ID}
+}
+
+// CreateBooking adds a booking and sets its ID
+func (m *memoryStore) CreateBooking(booking *models.Booking) error {
+	if err := normalizeBookingPhone(booking); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkOverlap(booking); err != nil {
+		return err
+	}
+
+	reference, err := m.newBookingReference()
+	if err != nil {
+		return err
+	}
+
+	m.lastBookingID++
+	booking.Reference = reference
+	booking.ID = m.lastBookingID
+	booking.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	booking.UpdatedAt = booking.CreatedAt
+	booking.Version = 1
+	m.bookings[booking.ID] = *booking
+	return nil
+}
+
+// UpdateBooking replaces a booking and increments its version, booking.Version must be
+// the stored version
+func (m *memoryStore) UpdateBooking(booking *models.Booking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkOverlap(booking); err != nil {
+		return err
+	}
+
+	stored, ok := m.bookings[booking.ID]
+	if !ok || stored.Version != booking.Version {
+		return ErrBookingVersionConflict
+	}
+
+	// A number saved before numbers were checked may stay while it does not change
+	if err := normalizeBookingPhone(booking); err != nil && booking.PhoneNumber != stored.PhoneNumber {
+		return err
+	}
+
+	booking.Reference = stored.Reference
+	booking.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	booking.Version++
+	m.bookings[booking.ID] = *booking
+	return nil
+}
+
+// DeleteBooking removes a booking
+func (m *memoryStore) DeleteBooking(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.bookings, id)
+	return nil
+}
+
+// GetBookedHouseIDs returns the houses with an active booking overlapping checkIn-checkOut
+func (m *memoryStore) GetBookedHouseIDs(checkIn, checkOut string) (map[int]bool, error) {
+	checkOut, err := stayCheckOut(checkIn, checkOut)
+	if err != nil {
+		return nil, err
+	}
+
+	bookings, err := m.GetActiveBookingsBetween(checkIn, checkOut)
+	if err != nil {
+		return nil, err
+	}
+
+	booked := make(map[int]bool)
+	for _, booking := range bookings {
+		booked[booking.HouseID] = true
+	}
+	return booked, nil
+}
+
+// GetActiveBookingsBetween returns the active bookings of catalog houses overlapping from-to
+func (m *memoryStore) GetActiveBookingsBetween(from, to string) ([]models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBookings(func(b models.Booking) bool {
+		return b.HouseID != 0 && booking_lifecycle.IsActive(b.Status) && b.CheckIn < to && b.CheckOut > from
+	}), nil
+}
+
+// BackfillBookingHouses links bookings without a house ID to the house with the same name
+func (m *memoryStore) BackfillBookingHouses() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, booking := range m.bookings {
+		if booking.HouseID != 0 {
+			continue
+		}
+		for _, house := range m.houses {
+			if strings.EqualFold(house.Name, booking.ResortName) {
+				booking.HouseID = house.ID
+				m.bookings[id] = booking
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// BackfillBookingReferences gives bookings without a reference code a new one
+func (m *memoryStore) BackfillBookingReferences() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, booking := range m.bookings {
+		if booking.Reference != "" {
+			continue
+		}
+		reference, err := m.newBookingReference()
+		if err != nil {
+			return err
+		}
+		booking.Reference = reference
+		m.bookings[id] = booking
+	}
+	return nil
+}
+
+// GetHouses returns every house
+func (m *memoryStore) GetHouses() ([]models.House, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterHouses(func(models.House) bool { return true }), nil
+}
+
+// GetHouseByID returns a house by its ID
+func (m *memoryStore) GetHouseByID(id int) (*models.House, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	house, ok := m.houses[id]
+	if !ok {
+		return nil, nil
+	}
+	house = copyHouse(house)
+	return &house, nil
+}
+
+// GetHouseByName returns a house by its name, ignoring case
+func (m *memoryStore) GetHouseByName(name string) (*models.House, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	houses := m.filterHouses(func(h models.House) bool { return strings.EqualFold(h.Name, strings.TrimSpace(name)) })
+	if len(houses) == 0 {
+		return nil, nil
+	}
+	return &houses[0], nil
+}
+
+// SearchHouses returns the houses whose name or location contains query, ignoring case
+func (m *memoryStore) SearchHouses(query string) ([]models.House, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	query = strings.ToLower(query)
+	return m.filterHouses(func(h models.House) bool {
+		return strings.Contains(strings.ToLower(h.Name), query) || strings.Contains(strings.ToLower(h.Location), query)
+	}), nil
+}
+
+// GetHousesByGuests returns the houses that accommodate at least guests
+func (m *memoryStore) GetHousesByGuests(guests int) ([]models.House, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterHouses(func(h models.House) bool { return h.Guests >= guests }), nil
+}
+
+// CreateHouse adds a house and sets its ID
+func (m *memoryStore) CreateHouse(house *models.House) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastHouseID++
+	house.ID = m.lastHouseID
+	m.houses[house.ID] = copyHouse(*house)
+	return nil
+}
+
+// UpdateHouse replaces a house
+func (m *memoryStore) UpdateHouse(house *models.House) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.houses[house.ID]; ok {
+		m.houses[house.ID] = copyHouse(*house)
+	}
+	return nil
+}
+
+// DeleteHouse removes a house that has no bookings
+func (m *memoryStore) DeleteHouse(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.filterBookings(func(b models.Booking) bool { return b.HouseID == id })) > 0 {
+		return ErrHouseHasBookings
+	}
+	delete(m.houses, id)
+	return nil
+}
+
+// CountHouses returns how many houses there are
+func (m *memoryStore) CountHouses() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.houses), nil
+}
+
+// SeedHouses adds the houses with their IDs, replacing houses with the same ID
+func (m *memoryStore) SeedHouses(houses []models.House) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, house := range houses {
+		m.houses[house.ID] = copyHouse(house)
+		if house.ID > m.lastHouseID {
+			m.lastHouseID = house.ID
+		}
+	}
+	return nil
+}
+
+// CreateConversation starts a conversation with a random ID
+func (m *memoryStore) CreateConversation() (*models.Conversation, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	conversation := models.Conversation{ID: hex.EncodeToString(idBytes), CreatedAt: now, UpdatedAt: now}
+	m.conversations[conversation.ID] = conversation
+	return &conversation, nil
+}
+
+// GetConversationByID returns a conversation by its ID
+func (m *memoryStore) GetConversationByID(id string) (*models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, ok := m.conversations[id]
+	if !ok {
+		return nil, nil
+	}
+	return &conversation, nil
+}
+
+// GetAllConversations returns every conversation, most recently active first
+func (m *memoryStore) GetAllConversations() ([]models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var conversations []models.Conversation
+	for _, conversation := range m.conversations {
+		conversations = append(conversations, conversation)
+	}
+	sort.Slice(conversations, func(i, j int) bool { return conversations[i].UpdatedAt.After(conversations[j].UpdatedAt) })
+	return conversations, nil
+}
+
+// UpdateConversationBookingState stores the booking dialogue state of a conversation
+func (m *memoryStore) UpdateConversationBookingState(id, bookingState string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conversation, ok := m.conversations[id]; ok {
+		conversation.BookingState = bookingState
+		conversation.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+		m.conversations[id] = conversation
+	}
+	return nil
+}
+
+// AddConversationMessage appends a message to a conversation
+func (m *memoryStore) AddConversationMessage(message *models.ConversationMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastMessageID++
+	message.ID = m.lastMessageID
+	message.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	m.messages[message.ConversationID] = append(m.messages[message.ConversationID], *message)
+
+	if conversation, ok := m.conversations[message.ConversationID]; ok {
+		conversation.UpdatedAt = message.CreatedAt
+		m.conversations[message.ConversationID] = conversation
+	}
+	return nil
+}
+
+// GetConversationMessages returns the messages of a conversation in the order they were added
+func (m *memoryStore) GetConversationMessages(conversationID string) ([]models.ConversationMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.ConversationMessage(nil), m.messages[conversationID]...), nil
+}
+
+// GetAllStaff returns every staff account, ordered by ID
+func (m *memoryStore) GetAllStaff() ([]models.Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var accounts []models.Staff
+	for _, staff := range m.staff {
+		accounts = append(accounts, staff)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+// GetStaffByID returns a staff account by its ID
+func (m *memoryStore) GetStaffByID(id int) (*models.Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	staff, ok := m.staff[id]
+	if !ok {
+		return nil, nil
+	}
+	return &staff, nil
+}
+
+// GetStaffByUsername returns a staff account by its username, ignoring case
+func (m *memoryStore) GetStaffByUsername(username string) (*models.Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, staff := range m.staff {
+		if strings.EqualFold(staff.Username, strings.TrimSpace(username)) {
+			return &staff, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateStaff adds a staff account and sets its ID
+func (m *memoryStore) CreateStaff(staff *models.Staff) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastStaffID++
+	staff.ID = m.lastStaffID
+	staff.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	m.staff[staff.ID] = *staff
+	return nil
+}
+
+// UpdateStaff replaces a staff account
+func (m *memoryStore) UpdateStaff(staff *models.Staff) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.staff[staff.ID]; ok {
+		m.staff[staff.ID] = *staff
+	}
+	return nil
+}
+
+// DeleteStaff removes a staff account
+func (m *memoryStore) DeleteStaff(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.staff, id)
+	return nil
+}
+
+// CountStaff returns how many staff accounts there are
+func (m *memoryStore) CountStaff() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.staff), nil
+}
+
+// ReserveIdempotencyKey records that the first request with key has started, or returns
+// the record of the key when it is already recorded and not expired
+func (m *memoryStore) ReserveIdempotencyKey(key, requestHash string, expiresAt time.Time) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	if record, ok := m.idempotency[key]; ok && record.ExpiresAt.After(now) {
+		return &record, nil
+	}
+
+	m.idempotency[key] = models.IdempotencyRecord{Key: key, RequestHash: requestHash, CreatedAt: now.Truncate(time.Second), ExpiresAt: expiresAt.UTC()}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the outcome of the request with key
+func (m *memoryStore) CompleteIdempotencyKey(key string, statusCode int, headers map[string]string, response string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, ok := m.idempotency[key]; ok {
+		record.StatusCode = statusCode
+		record.Headers = headers
+		record.Response = response
+		m.idempotency[key] = record
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a key whose request failed, so it can be retried
+func (m *memoryStore) ReleaseIdempotencyKey(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idempotency, key)
+	return nil
+}
+
+// GetPhoneVerification returns the code sent for scope
+func (m *memoryStore) GetPhoneVerification(scope string) (*models.PhoneVerification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	verification, ok := m.verifications[scope]
+	if !ok {
+		return nil, nil
+	}
+	return &verification, nil
+}
+
+// SavePhoneVerification stores a newly sent code, replacing the earlier code of its scope
+func (m *memoryStore) SavePhoneVerification(verification *models.PhoneVerification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for scope, stored := range m.verifications {
+		if !stored.ExpiresAt.After(now) {
+			delete(m.verifications, scope)
+		}
+	}
+
+	stored := *verification
+	stored.Attempts = 0
+	stored.VerifiedAt = nil
+	m.verifications[verification.Scope] = stored
+	return nil
+}
+
+// ReservePhoneVerificationAttempt counts an attempt at entering the code of scope, unless
+// maxAttempts were already counted
+func (m *memoryStore) ReservePhoneVerificationAttempt(scope string, maxAttempts int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	verification, ok := m.verifications[scope]
+	if !ok || verification.Attempts >= maxAttempts {
+		return false, nil
+	}
+	verification.Attempts++
+	m.verifications[scope] = verification
+	return true, nil
+}
+
+// MarkPhoneVerified records that the code of scope was entered correctly and gives back the
+// attempt that entered it
+func (m *memoryStore) MarkPhoneVerified(scope string, verifiedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if verification, ok := m.verifications[scope]; ok {
+		verification.Attempts--
+		if verification.VerifiedAt == nil {
+			verifiedAt = verifiedAt.UTC()
+			verification.VerifiedAt = &verifiedAt
+		}
+		m.verifications[scope] = verification
+	}
+	return nil
+}
+
+// DeletePhoneVerification removes the code of scope
+func (m *memoryStore) DeletePhoneVerification(scope string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.verifications, scope)
+	return nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"resort-app-server/models"
+)
+
+// GetPhoneVerification retrieves the code sent for scope, or nil when there is none
+func (s *sqlStore) GetPhoneVerification(scope string) (*models.PhoneVerification, error) {
+	var verification models.PhoneVerification
+	var verifiedAt sql.NullTime
+	err := s.conn().queryRow("SELECT scope, phone_number, code_hash, attempts, sent_at, expires_at, verified_at FROM phone_verifications WHERE scope = ?", scope).
+		Scan(&verification.Scope, &verification.PhoneNumber, &verification.CodeHash, &verification.Attempts, &verification.SentAt, &verification.ExpiresAt, &verifiedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if verifiedAt.Valid {
+		verification.VerifiedAt = &verifiedAt.Time
+	}
+	return &verification, nil
+}
+
+// SavePhoneVerification stores a newly sent code, replacing the earlier code of its scope.
+// Expired codes are removed first.
+func (s *sqlStore) SavePhoneVerification(verification *models.PhoneVerification) error {
+	return s.inTx(func(tx sqlConn) error {
+		if _, err := tx.exec("DELETE FROM phone_verifications WHERE expires_at <= ? OR scope = ?", time.Now().UTC(), verification.Scope); err != nil {
+			return err
+		}
+
+		_, err := tx.exec("INSERT INTO phone_verifications (scope, phone_number, code_hash, attempts, sent_at, expires_at) VALUES (?, ?, ?, 0, ?, ?)",
+			verification.Scope, verification.PhoneNumber, verification.CodeHash, verification.SentAt.UTC(), verification.ExpiresAt.UTC())
+		return err
+	})
+}
+
+// ReservePhoneVerificationAttempt counts an attempt at entering the code of scope, unless
+// maxAttempts were already counted
+func (s *sqlStore) ReservePhoneVerificationAttempt(scope string, maxAttempts int) (bool, error) {
+	result, err := s.conn().exec("UPDATE phone_verifications SET attempts = attempts + 1 WHERE scope = ? AND attempts < ?", scope, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+	counted, err := result.RowsAffected()
+	return counted > 0, err
+}
+
+// MarkPhoneVerified records that the code of scope was entered correctly and gives back the
+// attempt that entered it
+func (s *sqlStore) MarkPhoneVerified(scope string, verifiedAt time.Time) error {
+	_, err := s.conn().exec("UPDATE phone_verifications SET attempts = attempts - 1, verified_at = COALESCE(verified_at, ?) WHERE scope = ?", verifiedAt.UTC(), scope)
+	return err
+}
+
+// DeletePhoneVerification removes the code of scope
+func (s *sqlStore) DeletePhoneVerification(scope string) error {
+	_, err := s.conn().exec("DELETE FROM phone_verifications WHERE scope = ?", scope)
+	return err
+}
@@ -1,91 +1,214 @@
 package repository
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"resort-app-server/database"
 	"resort-app-server/models"
 	"strings"
 )
 
-// GetHouses retrieves all houses from the JSON file
-func GetHouses() ([]models.House, error) {
-	// Get the absolute path to the resorts.json file
-	currentDir, err := os.Getwd()
+// houseColumns are the columns read by scanHouse, in order
+const houseColumns = "id, name, description, location, rating, price_per_night, image_url, guests"
+
+// scanHouse reads a row selected with houseColumns, without the amenities
+func scanHouse(row rowScanner) (*models.House, error) {
+	var house models.House
+	err := row.Scan(&house.ID, &house.Name, &house.Description, &house.Location, &house.Rating, &house.PricePerNight, &house.ImageURL, &house.Guests)
 	if err != nil {
 		return nil, err
 	}
+	return &house, nil
+}
 
-	filePath := filepath.Join(currentDir, "data", "houses.json")
-
-	// Read the JSON file
-	data, err := os.ReadFile(filePath)
+// queryHouses retrieves the houses selected by a query on houseColumns, with their amenities
+func (s *sqlStore) queryHouses(query string, args ...interface{}) ([]models.House, error) {
+	rows, err := s.conn().query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Parse the JSON data
 	var houses []models.House
-	err = json.Unmarshal(data, &houses)
-	if err != nil {
+	for rows.Next() {
+		house, err := scanHouse(rows)
+		if err != nil {
+			return nil, err
+		}
+		houses = append(houses, *house)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
+	if err := s.loadAmenities(houses); err != nil {
+		return nil, err
+	}
 	return houses, nil
 }
 
-// GetHouseByID retrieves a specific house by its ID
-func GetHouseByID(id int) (*models.House, error) {
-	houses, err := GetHouses()
-	if err != nil {
-		return nil, err
+// loadAmenities fills in the amenities of the houses, in the order they were listed
+func (s *sqlStore) loadAmenities(houses []models.House) error {
+	if len(houses) == 0 {
+		return nil
+	}
+
+	ids := make([]interface{}, len(houses))
+	for i, house := range houses {
+		ids[i] = house.ID
 	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
 
-	for _, house := range houses {
-		if house.ID == id {
-			return &house, nil
+	rows, err := s.conn().query("SELECT house_id, amenity FROM house_amenities WHERE house_id IN ("+placeholders+") ORDER BY house_id, position", ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	amenities := make(map[int][]string)
+	for rows.Next() {
+		var houseID int
+		var amenity string
+		if err := rows.Scan(&houseID, &amenity); err != nil {
+			return err
 		}
+		amenities[houseID] = append(amenities[houseID], amenity)
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	return nil, nil
+	for i := range houses {
+		houses[i].Amenities = append([]string{}, amenities[houses[i].ID]...)
+	}
+	return nil
 }
 
-// SearchHouses searches for houses by name or location
-func SearchHouses(query string) ([]models.House, error) {
-	houses, err := GetHouses()
-	if err != nil {
+// GetHouses retrieves all houses of the catalog
+func (s *sqlStore) GetHouses() ([]models.House, error) {
+	return s.queryHouses("SELECT " + houseColumns + " FROM houses ORDER BY id")
+}
+
+// GetHouseByID retrieves a specific house by its ID
+func (s *sqlStore) GetHouseByID(id int) (*models.House, error) {
+	houses, err := s.queryHouses("SELECT "+houseColumns+" FROM houses WHERE id = ?", id)
+	if err != nil || len(houses) == 0 {
+		return nil, err
+	}
+	return &houses[0], nil
+}
+
+// GetHouseByName retrieves a house by its name, ignoring case
+func (s *sqlStore) GetHouseByName(name string) (*models.House, error) {
+	houses, err := s.queryHouses("SELECT "+houseColumns+" FROM houses WHERE lower(name) = lower(?)", strings.TrimSpace(name))
+	if err != nil || len(houses) == 0 {
 		return nil, err
 	}
+	return &houses[0], nil
+}
 
-	var results []models.House
-	queryLower := strings.ToLower(query)
+// SearchHouses searches for houses by name or location
+func (s *sqlStore) SearchHouses(query string) ([]models.House, error) {
+	pattern := "%" + escapeLike(strings.ToLower(query)) + "%"
+	return s.queryHouses("SELECT "+houseColumns+` FROM houses WHERE lower(name) LIKE ? ESCAPE '\' OR lower(location) LIKE ? ESCAPE '\' ORDER BY id`, pattern, pattern)
+}
 
-	for _, house := range houses {
-		// Check if query matches house name or location
-		nameLower := strings.ToLower(house.Name)
-		locationLower := strings.ToLower(house.Location)
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
 
-		if strings.Contains(nameLower, queryLower) || strings.Contains(locationLower, queryLower) {
-			results = append(results, house)
+// GetHousesByGuests retrieves the houses that accommodate at least guests
+func (s *sqlStore) GetHousesByGuests(guests int) ([]models.House, error) {
+	return s.queryHouses("SELECT "+houseColumns+" FROM houses WHERE guests >= ? ORDER BY id", guests)
+}
+
+// CreateHouse adds a house to the catalog and sets its ID
+func (s *sqlStore) CreateHouse(house *models.House) error {
+	return s.inTx(func(tx sqlConn) error {
+		err := tx.queryRow("INSERT INTO houses (name, description, location, rating, price_per_night, image_url, guests) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id",
+			house.Name, house.Description, house.Location, house.Rating, house.PricePerNight, house.ImageURL, house.Guests).Scan(&house.ID)
+		if err != nil {
+			return err
 		}
-	}
 
-	return results, nil
+		return saveAmenities(tx, house.ID, house.Amenities)
+	})
 }
 
-// GetHousesByGuests returns houses that can accommodate at least the specified number of guests
-func GetHousesByGuests(guests int) ([]models.House, error) {
-	houses, err := GetHouses()
-	if err != nil {
-		return nil, err
-	}
+// UpdateHouse replaces the details and amenities of a house. Bookings keep the name
+// the house had when they were made.
+func (s *sqlStore) UpdateHouse(house *models.House) error {
+	return s.inTx(func(tx sqlConn) error {
+		_, err := tx.exec("UPDATE houses SET name = ?, description = ?, location = ?, rating = ?, price_per_night = ?, image_url = ?, guests = ? WHERE id = ?",
+			house.Name, house.Description, house.Location, house.Rating, house.PricePerNight, house.ImageURL, house.Guests, house.ID)
+		if err != nil {
+			return err
+		}
+
+		return saveAmenities(tx, house.ID, house.Amenities)
+	})
+}
 
-	var filteredHouses []models.House
-	for _, house := range houses {
-		if house.Guests >= guests {
-			filteredHouses = append(filteredHouses, house)
+// DeleteHouse removes a house and its amenities. Houses that have bookings cannot be
+// deleted, ErrHouseHasBookings is returned instead.
+func (s *sqlStore) DeleteHouse(id int) error {
+	return s.inTx(func(tx sqlConn) error {
+		var bookings int
+		if err := tx.queryRow("SELECT COUNT(*) FROM bookings WHERE house_id = ?", id).Scan(&bookings); err != nil {
+			return err
 		}
+		if bookings > 0 {
+			return ErrHouseHasBookings
+		}
+
+		_, err := tx.exec("DELETE FROM houses WHERE id = ?", id)
+		return err
+	})
+}
+
+// CountHouses counts the houses of the catalog. Houses without a guest capacity are the
+// bare names copied by earlier versions of the server and do not count.
+func (s *sqlStore) CountHouses() (int, error) {
+	var count int
+	err := s.conn().queryRow("SELECT COUNT(*) FROM houses WHERE guests > 0").Scan(&count)
+	return count, err
+}
+
+// SeedHouses adds the houses with their IDs, replacing houses with the same ID
+func (s *sqlStore) SeedHouses(houses []models.House) error {
+	return s.inTx(func(tx sqlConn) error {
+		for _, house := range houses {
+			_, err := tx.exec("INSERT INTO houses ("+houseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?) "+
+				"ON CONFLICT(id) DO UPDATE SET name = excluded.name, description = excluded.description, location = excluded.location, "+
+				"rating = excluded.rating, price_per_night = excluded.price_per_night, image_url = excluded.image_url, guests = excluded.guests",
+				house.ID, house.Name, house.Description, house.Location, house.Rating, house.PricePerNight, house.ImageURL, house.Guests)
+			if err != nil {
+				return err
+			}
+			if err := saveAmenities(tx, house.ID, house.Amenities); err != nil {
+				return err
+			}
+		}
+
+		// Postgres does not advance the ID sequence for explicit IDs
+		if s.db.Driver == database.Postgres {
+			_, err := tx.exec("SELECT setval(pg_get_serial_sequence('houses', 'id'), (SELECT COALESCE(MAX(id), 1) FROM houses))")
+			return err
+		}
+		return nil
+	})
+}
+
+// saveAmenities replaces the amenities of a house
+func saveAmenities(tx sqlConn, houseID int, amenities []string) error {
+	if _, err := tx.exec("DELETE FROM house_amenities WHERE house_id = ?", houseID); err != nil {
+		return err
 	}
 
-	return filteredHouses, nil
+	for position, amenity := range amenities {
+		_, err := tx.exec("INSERT INTO house_amenities (house_id, position, amenity) VALUES (?, ?, ?)", houseID, position, amenity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"resort-app-server/database"
+)
+
+// sqlStore implements the stores on SQLite and Postgres. Queries are written with ?
+// placeholders and rebound for the driver.
+type sqlStore struct {
+	db *database.Database
+}
+
+// sqlQuerier is implemented by *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqlConn runs queries on the database or a transaction, rebinding their placeholders
+type sqlConn struct {
+	q  sqlQuerier
+	db *database.Database
+}
+
+func (c sqlConn) exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.q.Exec(c.db.Rebind(query), args...)
+}
+
+func (c sqlConn) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.q.Query(c.db.Rebind(query), args...)
+}
+
+func (c sqlConn) queryRow(query string, args ...interface{}) *sql.Row {
+	return c.q.QueryRow(c.db.Rebind(query), args...)
+}
+
+// conn runs queries outside of a transaction
+func (s *sqlStore) conn() sqlConn {
+	return sqlConn{q: s.db.DB, db: s.db}
+}
+
+// inTx runs fn in a transaction that is committed when fn returns nil
+func (s *sqlStore) inTx(fn func(tx sqlConn) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(sqlConn{q: tx, db: s.db}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// formatDate converts a DATE or TIMESTAMP column to text. The drivers return them as
+// time.Time, which would otherwise be stored back in a different format.
+// NULL and empty values become an empty string.
+func formatDate(value interface{}, layout string) string {
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(layout)
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+// nullIfEmpty stores an empty date or timestamp as NULL, Postgres rejects empty strings
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// houseIDValue stores an unset house ID as NULL, the foreign key rejects 0
+func houseIDValue(houseID int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(houseID), Valid: houseID != 0}
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"resort-app-server/models"
+)
+
+// staffColumns are the columns read by scanStaff, in order
+const staffColumns = "id, username, password_hash, role, created_at"
+
+// scanStaff reads a row selected with staffColumns
+func scanStaff(row rowScanner) (*models.Staff, error) {
+	var staff models.Staff
+	if err := row.Scan(&staff.ID, &staff.Username, &staff.PasswordHash, &staff.Role, &staff.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+// GetAllStaff retrieves every staff account
+func (s *sqlStore) GetAllStaff() ([]models.Staff, error) {
+	rows, err := s.conn().query("SELECT " + staffColumns + " FROM staff ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []models.Staff
+	for rows.Next() {
+		staff, err := scanStaff(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *staff)
+	}
+	return accounts, rows.Err()
+}
+
+// GetStaffByID retrieves a staff account by its ID
+func (s *sqlStore) GetStaffByID(id int) (*models.Staff, error) {
+	staff, err := scanStaff(s.conn().queryRow("SELECT "+staffColumns+" FROM staff WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return staff, err
+}
+
+// GetStaffByUsername retrieves a staff account by its username, ignoring case
+func (s *sqlStore) GetStaffByUsername(username string) (*models.Staff, error) {
+	staff, err := scanStaff(s.conn().queryRow("SELECT "+staffColumns+" FROM staff WHERE lower(username) = lower(?)", strings.TrimSpace(username)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return staff, err
+}
+
+// CreateStaff adds a staff account and sets its ID
+func (s *sqlStore) CreateStaff(staff *models.Staff) error {
+	return s.conn().queryRow("INSERT INTO staff (username, password_hash, role) VALUES (?, ?, ?) RETURNING id, created_at",
+		staff.Username, staff.PasswordHash, staff.Role).Scan(&staff.ID, &staff.CreatedAt)
+}
+
+// UpdateStaff saves the username, password and role of a staff account
+func (s *sqlStore) UpdateStaff(staff *models.Staff) error {
+	_, err := s.conn().exec("UPDATE staff SET username = ?, password_hash = ?, role = ? WHERE id = ?",
+		staff.Username, staff.PasswordHash, staff.Role, staff.ID)
+	return err
+}
+
+// DeleteStaff removes a staff account
+func (s *sqlStore) DeleteStaff(id int) error {
+	_, err := s.conn().exec("DELETE FROM staff WHERE id = ?", id)
+	return err
+}
+
+// CountStaff counts the staff accounts
+func (s *sqlStore) CountStaff() (int, error) {
+	var count int
+	err := s.conn().queryRow("SELECT COUNT(*) FROM staff").Scan(&count)
+	return count, err
+}
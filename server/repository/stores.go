@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"resort-app-server/database"
+	"resort-app-server/models"
+	"resort-app-server/phone_number"
+)
+
+// DateLayout is the format of booking dates
+const DateLayout = "2006-01-02"
+
+// BookingStore persists bookings
+type BookingStore interface {
+	GetAllBookings() ([]models.Booking, error)
+	// GetBookingByID returns nil when the booking does not exist
+	GetBookingByID(id int) (*models.Booking, error)
+	// GetBookingByReference returns nil when no booking has the reference code
+	GetBookingByReference(reference string) (*models.Booking, error)
+	GetBookingsByStatus(status string) ([]models.Booking, error)
+	GetBookingsByUserID(userID int) ([]models.Booking, error)
+	// GetBookingsByCustomerInfo matches the phone number in any form Normalize accepts
+	GetBookingsByCustomerInfo(name, phone string) ([]models.Booking, error)
+	// CreateBooking gives the booking a new reference code, which never changes afterwards.
+	// CreateBooking and UpdateBooking store the phone number in E.164 form and fail with a
+	// *phone_number.InvalidError when it cannot be a phone number. A number saved before
+	// numbers were checked is kept by UpdateBooking while it does not change.
+	// CreateBooking and UpdateBooking fail with a *BookingConflictError when the house
+	// is already booked for the stay. UpdateBooking increments the version and fails with
+	// ErrBookingVersionConflict when booking.Version is no longer the stored version.
+	CreateBooking(booking *models.Booking) error
+	UpdateBooking(booking *models.Booking) error
+	DeleteBooking(id int) error
+	// GetBookedHouseIDs returns the houses with an active booking overlapping checkIn-checkOut
+	GetBookedHouseIDs(checkIn, checkOut string) (map[int]bool, error)
+	// GetActiveBookingsBetween returns the active bookings of catalog houses overlapping from-to
+	GetActiveBookingsBetween(from, to string) ([]models.Booking, error)
+	// BackfillBookingHouses links bookings without a house ID to the house with the same name
+	BackfillBookingHouses() error
+	// BackfillBookingReferences gives bookings without a reference code a new one
+	BackfillBookingReferences() error
+}
+
+// HouseStore persists the house catalog
+type HouseStore interface {
+	GetHouses() ([]models.House, error)
+	// GetHouseByID and GetHouseByName return nil when the house does not exist
+	GetHouseByID(id int) (*models.House, error)
+	GetHouseByName(name string) (*models.House, error)
+	SearchHouses(query string) ([]models.House, error)
+	// GetHousesByGuests returns the houses that accommodate at least guests, booked or not
+	GetHousesByGuests(guests int) ([]models.House, error)
+	CreateHouse(house *models.House) error
+	UpdateHouse(house *models.House) error
+	// DeleteHouse fails with ErrHouseHasBookings when bookings reference the house
+	DeleteHouse(id int) error
+	// CountHouses returns how many houses the catalog has
+	CountHouses() (int, error)
+	// SeedHouses adds the houses with their IDs, replacing houses with the same ID
+	SeedHouses(houses []models.House) error
+}
+
+// ConversationStore persists chat sessions and their messages
+type ConversationStore interface {
+	CreateConversation() (*models.Conversation, error)
+	// GetConversationByID returns nil when the conversation does not exist
+	GetConversationByID(id string) (*models.Conversation, error)
+	GetAllConversations() ([]models.Conversation, error)
+	UpdateConversationBookingState(id, bookingState string) error
+	AddConversationMessage(message *models.ConversationMessage) error
+	GetConversationMessages(conversationID string) ([]models.ConversationMessage, error)
+}
+
+// StaffStore persists the staff accounts
+type StaffStore interface {
+	GetAllStaff() ([]models.Staff, error)
+	// GetStaffByID and GetStaffByUsername return nil when the account does not exist
+	GetStaffByID(id int) (*models.Staff, error)
+	GetStaffByUsername(username string) (*models.Staff, error)
+	CreateStaff(staff *models.Staff) error
+	UpdateStaff(staff *models.Staff) error
+	DeleteStaff(id int) error
+	CountStaff() (int, error)
+}
+
+// IdempotencyStore remembers the outcome of requests that must not be repeated, such as
+// creating a booking, so a retry gets the outcome of the first request
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey starts the request with key. It returns nil when the key is new,
+	// otherwise the recorded request, whose StatusCode is 0 while it is still in progress.
+	ReserveIdempotencyKey(key, requestHash string, expiresAt time.Time) (*models.IdempotencyRecord, error)
+	// CompleteIdempotencyKey stores the outcome of the request with key
+	CompleteIdempotencyKey(key string, statusCode int, headers map[string]string, response string) error
+	// ReleaseIdempotencyKey forgets a key whose request failed, so it can be retried
+	ReleaseIdempotencyKey(key string) error
+}
+
+// PhoneVerificationStore persists the one-time codes that verify phone numbers, one code
+// per scope
+type PhoneVerificationStore interface {
+	// GetPhoneVerification returns nil when no code was sent for scope
+	GetPhoneVerification(scope string) (*models.PhoneVerification, error)
+	// SavePhoneVerification stores a newly sent code, replacing the earlier code of its scope
+	SavePhoneVerification(verification *models.PhoneVerification) error
+	// ReservePhoneVerificationAttempt counts an attempt at entering the code of scope before
+	// it is checked, so concurrent guesses cannot exceed the limit. It returns false when
+	// maxAttempts were already counted or there is no code.
+	ReservePhoneVerificationAttempt(scope string, maxAttempts int) (bool, error)
+	// MarkPhoneVerified records that the code of scope was entered correctly and gives back
+	// the attempt that entered it
+	MarkPhoneVerified(scope string, verifiedAt time.Time) error
+	DeletePhoneVerification(scope string) error
+}
+
+// Stores groups the stores the server works with
+type Stores struct {
+	Bookings      BookingStore
+	Houses        HouseStore
+	Conversations ConversationStore
+	Staff         StaffStore
+	Idempotency   IdempotencyStore
+	Verifications PhoneVerificationStore
+
+	close func() error
+}
+
+// NewSQLStores returns the stores backed by an open SQLite or Postgres database
+func NewSQLStores(db *database.Database) *Stores {
+	store := &sqlStore{db: db}
+	return &Stores{Bookings: store, Houses: store, Conversations: store, Staff: store, Idempotency: store, Verifications: store, close: db.Close}
+}
+
+// NewMemoryStores returns stores that keep everything in memory, for tests and demos
+func NewMemoryStores() *Stores {
+	store := newMemoryStore()
+	return &Stores{Bookings: store, Houses: store, Conversations: store, Staff: store, Idempotency: store, Verifications: store}
+}
+
+// Close releases the database behind the stores
+func (s *Stores) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// BookingConflictError reports a booking that overlaps an active booking of the same house
+type BookingConflictError struct {
+	HouseName     string
+	CheckIn       string
+	CheckOut      string
+	ConflictingID int
+}
+
+func (e *BookingConflictError) Error() string {
+	return fmt.Sprintf("%s is already booked between %s and %s", e.HouseName, e.CheckIn, e.CheckOut)
+}
+
+// ErrBookingVersionConflict is returned when a booking was changed or deleted after it was read
+var ErrBookingVersionConflict = errors.New("booking was changed by another request")
+
+// ErrHouseHasBookings is returned when deleting a house that bookings still reference
+var ErrHouseHasBookings = errors.New("house has bookings")
+
+// stayCheckOut returns the check-out date of a stay, an empty checkOut means a single night
+func stayCheckOut(checkIn, checkOut string) (string, error) {
+	if checkOut != "" {
+		return checkOut, nil
+	}
+	start, err := time.Parse(DateLayout, checkIn)
+	if err != nil {
+		return "", err
+	}
+	return start.AddDate(0, 0, 1).Format(DateLayout), nil
+}
+
+// normalizeBookingPhone puts the phone number of a booking in E.164 form, see
+// phone_number.Normalize. Bookings without a phone number are left alone.
+func normalizeBookingPhone(booking *models.Booking) error {
+	if booking.PhoneNumber == "" {
+		return nil
+	}
+	phone, err := phone_number.Normalize(booking.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	booking.PhoneNumber = phone
+	return nil
+}
+
+// lookupPhone returns the form of a phone number to look bookings up by. Numbers that
+// cannot be normalized are looked up as they are, they may have been saved before
+// numbers were checked.
+func lookupPhone(phone string) string {
+	if normalized, err := phone_number.Normalize(phone); err == nil {
+		return normalized
+	}
+	return phone
+}
+
+// SeedHouses fills an empty house catalog from data/houses.json. Afterwards the houses
+// are managed through the admin API and the file is not read.
+func (s *Stores) SeedHouses() error {
+	count, err := s.Houses.CountHouses()
+	if err != nil || count > 0 {
+		return err
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(currentDir, "data", "houses.json"))
+	if os.IsNotExist(err) {
+		log.Println("No data/houses.json found, starting with an empty house catalog")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var houses []models.House
+	if err := json.Unmarshal(data, &houses); err != nil {
+		return err
+	}
+
+	if err := s.Houses.SeedHouses(houses); err != nil {
+		return err
+	}
+
+	log.Printf("Seeded the house catalog with %d houses from data/houses.json", len(houses))
+	return nil
+}
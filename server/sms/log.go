@@ -0,0 +1,51 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogSender writes messages to the server log instead of sending them, and appends them to
+// a file when one is set. It is meant for development, where the codes are read from the
+// log or the file.
+type LogSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewLogSender creates a sender that logs messages and appends them to path, when set
+func NewLogSender(path string) (*LogSender, error) {
+	if path != "" {
+		// Fail on startup rather than on the first message
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open SMS log file: %v", err)
+		}
+		file.Close()
+	}
+	return &LogSender{path: path}, nil
+}
+
+// Send logs the message
+func (s *LogSender) Send(ctx context.Context, to, body string) error {
+	log.Printf("SMS to %s: %s", to, body)
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), to, body)
+	return err
+}
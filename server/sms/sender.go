@@ -0,0 +1,47 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sender delivers text messages to phone numbers
+type Sender interface {
+	// Send delivers body to the phone number to
+	Send(ctx context.Context, to, body string) error
+}
+
+// Config holds the settings used to build a Sender, see config.SMSConfig
+type Config struct {
+	Provider   string // log or twilio
+	LogFile    string // file the log sender appends messages to, besides the server log
+	APIURL     string // base URL of the Twilio-compatible API
+	AccountSID string
+	AuthToken  string
+	From       string // sender number or ID
+	Channel    string // sms or whatsapp
+}
+
+// New creates the sender selected by cfg.Provider
+func New(cfg Config) (Sender, error) {
+	var sender Sender
+	var err error
+
+	// Assign through the concrete constructors so a failed one never yields a non-nil interface
+	switch cfg.Provider {
+	case "log":
+		var s *LogSender
+		if s, err = NewLogSender(cfg.LogFile); err == nil {
+			sender = s
+		}
+	case "twilio":
+		var s *TwilioSender
+		if s, err = NewTwilioSender(cfg); err == nil {
+			sender = s
+		}
+	default:
+		err = fmt.Errorf("unknown SMS provider: %s", cfg.Provider)
+	}
+
+	return sender, err
+}
@@ -0,0 +1,101 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTwilioAPIURL is the API used when SMS_API_URL is not set
+const DefaultTwilioAPIURL = "https://api.twilio.com"
+
+// twilioTimeout bounds a request to the messaging API
+const twilioTimeout = 10 * time.Second
+
+// TwilioSender sends messages through the Twilio Messages API, or any API compatible with
+// it, as SMS or WhatsApp messages
+type TwilioSender struct {
+	client     *http.Client
+	endpoint   string
+	accountSID string
+	authToken  string
+	from       string
+	channel    string
+}
+
+// NewTwilioSender creates a sender for the Twilio-compatible API at cfg.APIURL
+func NewTwilioSender(cfg Config) (*TwilioSender, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" {
+		return nil, fmt.Errorf("the Twilio sender needs an account SID, an auth token and a sender number")
+	}
+	if cfg.Channel != "sms" && cfg.Channel != "whatsapp" {
+		return nil, fmt.Errorf("unknown SMS channel: %s", cfg.Channel)
+	}
+
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = DefaultTwilioAPIURL
+	}
+	if !strings.HasPrefix(apiURL, "http://") && !strings.HasPrefix(apiURL, "https://") {
+		return nil, fmt.Errorf("invalid SMS API URL: %s", apiURL)
+	}
+
+	return &TwilioSender{
+		client:     &http.Client{Timeout: twilioTimeout},
+		endpoint:   strings.TrimSuffix(apiURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(cfg.AccountSID) + "/Messages.json",
+		accountSID: cfg.AccountSID,
+		authToken:  cfg.AuthToken,
+		from:       cfg.From,
+		channel:    cfg.Channel,
+	}, nil
+}
+
+// Send posts the message to the API
+func (s *TwilioSender) Send(ctx context.Context, to, body string) error {
+	form := url.Values{
+		"To":   {s.address(to)},
+		"From": {s.address(s.from)},
+		"Body": {body},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.accountSID, s.authToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending the message failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// Twilio explains errors in the message field of a JSON body
+	var apiError struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &apiError) != nil || apiError.Message == "" {
+		apiError.Message = strings.TrimSpace(string(data))
+	}
+	return fmt.Errorf("sending the message failed with status %d: %s", resp.StatusCode, apiError.Message)
+}
+
+// address returns a phone number in the form the channel expects, WhatsApp numbers are
+// prefixed with whatsapp:
+func (s *TwilioSender) address(phone string) string {
+	if s.channel == "whatsapp" && !strings.HasPrefix(phone, "whatsapp:") {
+		return "whatsapp:" + phone
+	}
+	return phone
+}
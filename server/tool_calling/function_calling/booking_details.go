@@ -0,0 +1,217 @@
+package function_calling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"resort-app-server/booking_flow"
+	"resort-app-server/date_resolver"
+	"resort-app-server/pricing"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// BookingDetailsData represents the arguments of the update_booking_details tool.
+// Every field is optional, only the slots the user just provided are sent.
+type BookingDetailsData struct {
+	CheckIn          string `json:"check_in"`
+	CheckOut         string `json:"check_out"`
+	Nights           int    `json:"nights"`
+	Guests           int    `json:"guests"`
+	HouseName        string `json:"house_name"`
+	SummaryConfirmed bool   `json:"summary_confirmed"`
+	CustomerName     string `json:"customer_name"`
+	PhoneNumber      string `json:"phone_number"`
+	Restart          bool   `json:"restart"`
+}
+
+func (h *toolHandlers) updateBookingDetailsTool() Tool {
+	return Tool{
+		Name:        "update_booking_details",
+		Description: "Record booking details as soon as the user provides or confirms them. Returns the current step and the slots that are still missing.",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"check_in": {
+					Type:        jsonschema.String,
+					Description: "Confirmed check-in date in YYYY-MM-DD format",
+				},
+				"check_out": {
+					Type:        jsonschema.String,
+					Description: "Check-out date in YYYY-MM-DD format, when the user gives a date",
+				},
+				"nights": {
+					Type:        jsonschema.Integer,
+					Description: "Number of nights, when the user gives the length of the stay instead of a check-out date",
+				},
+				"guests": {
+					Type:        jsonschema.Integer,
+					Description: "Number of guests",
+				},
+				"house_name": {
+					Type:        jsonschema.String,
+					Description: "Name of the house the user selected",
+				},
+				"summary_confirmed": {
+					Type:        jsonschema.Boolean,
+					Description: "True once the user confirmed the booking summary",
+				},
+				"customer_name": {
+					Type:        jsonschema.String,
+					Description: "Full name of the customer",
+				},
+				"phone_number": {
+					Type:        jsonschema.String,
+					Description: "Phone number of the customer as they gave it, numbers without a country code are Indonesian",
+				},
+				"restart": {
+					Type:        jsonschema.Boolean,
+					Description: "True when the user cancels the summary and wants to start over",
+				},
+			},
+		},
+		Handler: h.handleUpdateBookingDetails,
+	}
+}
+
+// handleUpdateBookingDetails is the handler of the update_booking_details tool
+func (h *toolHandlers) handleUpdateBookingDetails(ctx context.Context, arguments json.RawMessage) (*ToolResult, error) {
+	state := booking_flow.FromContext(ctx)
+	if state == nil {
+		return nil, fmt.Errorf("no booking state in context")
+	}
+
+	var details BookingDetailsData
+	if err := json.Unmarshal(arguments, &details); err != nil {
+		return errorResult(fmt.Errorf("invalid arguments: %v", err)), nil
+	}
+
+	if details.Restart {
+		state.Reset()
+		return jsonResult(state.Summary())
+	}
+
+	// Slots are applied in dialogue order, the state machine rejects skipped steps
+	var note, message string
+	if details.CheckIn != "" {
+		checkIn := details.CheckIn
+		// Only the answer to the check-in question is checked against what the user wrote,
+		// later messages hold other dates such as the check-out. A stay offered because
+		// the houses were booked is taken as it is.
+		if state.CurrentStep() == booking_flow.StepCheckIn && !state.IsSuggestedCheckIn(checkIn) {
+			checkIn, note = resolveCheckIn(ctx, checkIn)
+		}
+		if err := state.SetCheckIn(checkIn, date_resolver.Today()); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	}
+
+	if details.CheckOut != "" {
+		if err := state.SetCheckOut(details.CheckOut); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	} else if details.Nights != 0 {
+		if err := state.SetNights(details.Nights); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	}
+
+	if details.Guests != 0 {
+		if err := state.SetGuests(details.Guests); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	}
+
+	if details.HouseName != "" {
+		house, err := h.stores.Houses.GetHouseByName(details.HouseName)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving houses: %v", err)
+		}
+		if house == nil {
+			return h.stateErrorResult(state, fmt.Errorf("unknown house: %s", details.HouseName))
+		}
+		if state.CheckIn != "" && state.CheckOut != "" {
+			available, err := h.stores.IsHouseAvailable(house.ID, state.CheckIn, state.CheckOut)
+			if err != nil {
+				return nil, fmt.Errorf("error checking availability: %v", err)
+			}
+			if !available {
+				return h.stateErrorResult(state, fmt.Errorf("%s is already booked between %s and %s, offer one of the houses returned by get_houses", house.Name, state.CheckIn, state.CheckOut))
+			}
+		}
+		if err := state.SelectHouse(house); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	}
+
+	if details.SummaryConfirmed {
+		if err := state.ConfirmSummary(); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	}
+
+	if details.CustomerName != "" || details.PhoneNumber != "" {
+		name, phone := details.CustomerName, details.PhoneNumber
+		if name == "" {
+			name = state.CustomerName
+		}
+		if phone == "" {
+			phone = state.PhoneNumber
+		}
+		if name != "" && phone != "" {
+			if err := state.SetContact(name, phone); err != nil {
+				return h.stateErrorResult(state, err)
+			}
+			// The number has to be verified before the booking can be saved
+			verification, err := h.requestPhoneVerification(ctx, state)
+			if err != nil {
+				return h.stateErrorResult(state, err)
+			}
+			message = verification
+		} else {
+			return h.stateErrorResult(state, fmt.Errorf("both the customer name and phone number are required"))
+		}
+	}
+
+	summary, err := h.bookingSummary(state)
+	if err != nil {
+		return nil, err
+	}
+	if note != "" {
+		summary["note"] = note
+	}
+	if message != "" {
+		summary["message"] = message
+	}
+	return jsonResult(summary)
+}
+
+// bookingSummary describes the state for the model, including the price quote
+// once a house is selected so it can be shown in the booking summary
+func (h *toolHandlers) bookingSummary(state *booking_flow.State) (map[string]interface{}, error) {
+	summary := state.Summary()
+	if state.HouseName == "" || state.CheckIn == "" || state.CheckOut == "" {
+		return summary, nil
+	}
+
+	quote, err := pricing.QuoteByHouseName(h.stores.Houses, state.HouseName, state.CheckIn, state.CheckOut)
+	if err != nil {
+		return nil, fmt.Errorf("error pricing the stay: %v", err)
+	}
+	summary["quote"] = quote
+	if state.CurrentStep() == booking_flow.StepSummary {
+		summary["message"] = "Show the booking summary including the total price from the quote and ask the user to confirm."
+	}
+	return summary, nil
+}
+
+// stateErrorResult reports a rejected slot together with the current state
+func (h *toolHandlers) stateErrorResult(state *booking_flow.State, err error) (*ToolResult, error) {
+	summary, summaryErr := h.bookingSummary(state)
+	if summaryErr != nil {
+		return nil, summaryErr
+	}
+	summary["error"] = err.Error()
+	return jsonResult(summary)
+}
@@ -0,0 +1,55 @@
+package function_calling
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"resort-app-server/date_resolver"
+)
+
+// maxDateLookback is how many recent user messages are searched for the check-in date
+const maxDateLookback = 6
+
+// UserMessage is a user turn of the conversation, with the time it was sent
+type UserMessage struct {
+	Text   string
+	SentAt time.Time
+}
+
+type userMessagesKey struct{}
+
+// WithUserMessages attaches the user turns of the conversation, oldest first, to a context
+func WithUserMessages(ctx context.Context, messages []UserMessage) context.Context {
+	return context.WithValue(ctx, userMessagesKey{}, messages)
+}
+
+// userMessagesFromContext returns the user turns attached to a context
+func userMessagesFromContext(ctx context.Context) []UserMessage {
+	messages, _ := ctx.Value(userMessagesKey{}).([]UserMessage)
+	return messages
+}
+
+// resolveCheckIn checks the check-in date chosen by the model against the most recent
+// date expression the user wrote, such as "besok" or "15/12", resolved deterministically
+// against the time the message was sent. The resolved date wins when they differ, and
+// the returned note explains the correction to the model. It is only meant for the
+// check-in step, afterwards the most recent date is usually the check-out.
+func resolveCheckIn(ctx context.Context, checkIn string) (string, string) {
+	messages := userMessagesFromContext(ctx)
+	for i, checked := len(messages)-1, 0; i >= 0 && checked < maxDateLookback; i, checked = i-1, checked+1 {
+		result, found := date_resolver.Resolve(messages[i].Text, messages[i].SentAt)
+		if !found {
+			continue
+		}
+
+		resolved := result.String()
+		if resolved == checkIn {
+			return checkIn, ""
+		}
+
+		return resolved, fmt.Sprintf("check_in corrected from %q to %s, which is what %q means relative to the date the user wrote it", checkIn, resolved, result.Expression)
+	}
+
+	return checkIn, ""
+}
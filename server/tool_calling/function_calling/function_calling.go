@@ -1,45 +1,128 @@
 package function_calling
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+
+	"resort-app-server/phone_verification"
+	"resort-app-server/repository"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
-// IsFunctionCallingExecuted checks if the AI response contains function calling instructions
-// by looking for the <BOOKING_DATA> or <HOUSE_LIST_DATA> tag in the message content
-func IsFunctionCallingExecuted(messageContent string) bool {
-	// Check if the message content contains the BOOKING_DATA or HOUSE_LIST_DATA tag
-	return FindStringIndex(messageContent, "<BOOKING_DATA>") != -1 ||
-		FindStringIndex(messageContent, "<HOUSE_LIST_DATA>") != -1 ||
-		FindStringIndex(messageContent, "<HOUSE-TYPE_DATA>") != -1
-}
-
-// ProcessFunctionCalling processes the appropriate function calling based on the AI response
-func ProcessFunctionCalling(messageContent string) (interface{}, bool, error) {
-	// Check for house list data first
-	houseListData, houseListFound := ExtractHouseListData(messageContent)
-	if houseListFound {
-		response, err := ProcessHouseListData(houseListData)
-		return response, true, err
+// ToolHandler executes a tool call with the raw JSON arguments sent by the model
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (*ToolResult, error)
+
+// Tool describes a function the model is allowed to call
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  jsonschema.Definition
+	Handler     ToolHandler
+}
+
+// ToolResult is the outcome of a tool call
+type ToolResult struct {
+	// Content is sent back to the model as the tool message
+	Content string
+	// Type and Data carry structured output for the client, e.g. "house_options"
+	Type string
+	Data interface{}
+}
+
+// Registry holds the tools available to the chat handler
+type Registry struct {
+	tools map[string]Tool
+	order []string
+}
+
+// toolHandlers implements the built-in tools on the injected stores
+type toolHandlers struct {
+	stores   *repository.Stores
+	verifier *phone_verification.Verifier // nil when phone numbers are not verified
+}
+
+// NewDefaultRegistry creates a registry with every built-in tool, working on the given
+// stores. With a verifier the phone number of a booking is verified before it is saved.
+func NewDefaultRegistry(stores *repository.Stores, verifier *phone_verification.Verifier) *Registry {
+	h := &toolHandlers{stores: stores, verifier: verifier}
+
+	registry := NewRegistry()
+	registry.Register(h.getHousesTool())
+	registry.Register(h.searchHousesTool())
+	registry.Register(h.updateBookingDetailsTool())
+	if verifier != nil {
+		registry.Register(h.verifyPhoneTool())
 	}
+	registry.Register(h.saveBookingTool())
+	return registry
+}
+
+// NewRegistry creates an empty tool registry
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
 
-	// Check for booking data
-	bookingData, bookingFound := ExtractBookingData(messageContent)
-	if bookingFound {
-		// Validate the booking data
-		if err := ValidateBookingData(bookingData); err != nil {
-			return nil, true, fmt.Errorf("invalid booking data: %v", err)
-		}
-
-		// Save booking to database
-		if err := SaveBookingToDatabase(bookingData); err != nil {
-			return nil, true, fmt.Errorf("failed to save booking: %v", err)
-		}
-
-		// Return a user-friendly message
-		return map[string]string{
-			"message": "Thank you! Your booking is now pending confirmation from our receptionist. We'll contact you shortly about the payment.",
-		}, true, nil
+// Register adds a tool to the registry, replacing any tool with the same name
+func (r *Registry) Register(tool Tool) {
+	if _, exists := r.tools[tool.Name]; !exists {
+		r.order = append(r.order, tool.Name)
 	}
+	r.tools[tool.Name] = tool
+}
+
+// Definitions returns the tools in the format expected by ChatCompletionRequest.Tools
+func (r *Registry) Definitions() []openai.Tool {
+	definitions := make([]openai.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		tool := r.tools[name]
+		definitions = append(definitions, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Execute runs a tool call returned by the model.
+// Unknown tools and malformed arguments are reported back to the model as the tool
+// result so it can correct itself; only failures of the handler itself return an error.
+func (r *Registry) Execute(ctx context.Context, call openai.ToolCall) (*ToolResult, error) {
+	tool, exists := r.tools[call.Function.Name]
+	if !exists {
+		return errorResult(fmt.Errorf("unknown tool: %s", call.Function.Name)), nil
+	}
+
+	arguments := json.RawMessage(call.Function.Arguments)
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	if !json.Valid(arguments) {
+		return errorResult(fmt.Errorf("arguments for %s are not valid JSON", call.Function.Name)), nil
+	}
+
+	log.Printf("Executing tool %s with arguments %s", call.Function.Name, arguments)
+	return tool.Handler(ctx, arguments)
+}
 
-	return nil, false, nil
+// errorResult builds a tool result that tells the model what went wrong
+func errorResult(err error) *ToolResult {
+	content, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return &ToolResult{Content: string(content)}
+}
+
+// jsonResult builds a tool result whose content is the JSON encoding of value
+func jsonResult(value interface{}) (*ToolResult, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling tool result: %v", err)
+	}
+	return &ToolResult{Content: string(content)}, nil
 }
@@ -1,16 +1,28 @@
 package function_calling
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
-	"resort-app-server/models"
-	"resort-app-server/repository"
+	"resort-app-server/booking_flow"
+	"resort-app-server/date_resolver"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
-// HouseListData represents the data structure for house list function calling
+// HouseListData represents the arguments of the get_houses tool
 type HouseListData struct {
 	Guests int `json:"guests"`
+	// CheckIn and CheckOut are taken from the booking state, not from the model
+	CheckIn  string `json:"-"`
+	CheckOut string `json:"-"`
+}
+
+// HouseSearchData represents the arguments of the search_houses tool
+type HouseSearchData struct {
+	Query string `json:"query"`
 }
 
 // HouseOption represents a house option for the frontend
@@ -22,108 +34,183 @@ type HouseOption struct {
 	ImageURL      string  `json:"image_url"`
 }
 
-// ExtractHouseListData extracts house list data from AI response when function calling is executed
-func ExtractHouseListData(messageContent string) (*HouseListData, bool) {
-	// Look for house list data in the format specified in the system prompt
-	startTag := "<HOUSE_LIST_DATA>"
-	endTag := "</HOUSE_LIST_DATA>"
-
-	startIdx := FindStringIndex(messageContent, startTag)
-	if startIdx == -1 {
-		return nil, false
+func (h *toolHandlers) getHousesTool() Tool {
+	return Tool{
+		Name:        "get_houses",
+		Description: "List the houses that can accommodate the given number of guests. Call this once the guest count is known so the user can pick a house.",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"guests": {
+					Type:        jsonschema.Integer,
+					Description: "Number of guests staying",
+				},
+			},
+			Required: []string{"guests"},
+		},
+		Handler: h.handleGetHouses,
 	}
+}
 
-	endIdx := FindStringIndex(messageContent, endTag)
-	if endIdx == -1 {
-		return nil, false
+func (h *toolHandlers) searchHousesTool() Tool {
+	return Tool{
+		Name:        "search_houses",
+		Description: "Search houses by name or location, e.g. when the user asks about a specific house.",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"query": {
+					Type:        jsonschema.String,
+					Description: "Part of a house name or location",
+				},
+			},
+			Required: []string{"query"},
+		},
+		Handler: h.handleSearchHouses,
 	}
+}
+
+// nearestDatesWindow is how many days around the requested check-in are searched for free dates
+const nearestDatesWindow = 30
 
-	// Extract the JSON data between the tags
-	houseListDataJSON := messageContent[startIdx+len(startTag) : endIdx]
-	// Clean up whitespace
-	houseListDataJSON = TrimString(houseListDataJSON)
+// maxNearestDates is how many alternative stays are suggested when everything is booked
+const maxNearestDates = 3
 
-	// Parse the JSON into a HouseListData struct
+// handleGetHouses is the handler of the get_houses tool
+func (h *toolHandlers) handleGetHouses(ctx context.Context, arguments json.RawMessage) (*ToolResult, error) {
 	var houseListData HouseListData
-	if err := json.Unmarshal([]byte(houseListDataJSON), &houseListData); err != nil {
-		fmt.Printf("Error parsing house list data: %v\n", err)
-		return nil, false
+	if err := json.Unmarshal(arguments, &houseListData); err != nil {
+		return errorResult(fmt.Errorf("invalid arguments: %v", err)), nil
 	}
 
-	return &houseListData, true
+	// Listing houses completes the guests step of the booking dialogue
+	state := booking_flow.FromContext(ctx)
+	if state == nil {
+		return nil, fmt.Errorf("no booking state in context")
+	}
+	if err := state.SetGuests(houseListData.Guests); err != nil {
+		return h.stateErrorResult(state, err)
+	}
+
+	// Availability is checked for the stay collected earlier in the dialogue
+	houseListData.CheckIn, houseListData.CheckOut = state.CheckIn, state.CheckOut
+
+	return h.ProcessHouseListData(state, &houseListData)
 }
 
-// GetHousesByGuestsForAI retrieves houses based on guest count for AI function calling
-func GetHousesByGuestsForAI(guests int) ([]models.House, error) {
-	return repository.GetHousesByGuests(guests)
+// handleSearchHouses is the handler of the search_houses tool
+func (h *toolHandlers) handleSearchHouses(ctx context.Context, arguments json.RawMessage) (*ToolResult, error) {
+	var searchData HouseSearchData
+	if err := json.Unmarshal(arguments, &searchData); err != nil {
+		return errorResult(fmt.Errorf("invalid arguments: %v", err)), nil
+	}
+
+	houses, err := h.stores.Houses.SearchHouses(searchData.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error searching houses: %v", err)
+	}
+
+	return jsonResult(map[string]interface{}{
+		"houses": houses,
+		"count":  len(houses),
+	})
 }
 
 // ProcessHouseListData processes house list data and returns a structured response
-func ProcessHouseListData(houseListData *HouseListData) (interface{}, error) {
-	// Get houses based on guest count
-	houses, err := GetHousesByGuestsForAI(houseListData.Guests)
+func (h *toolHandlers) ProcessHouseListData(state *booking_flow.State, houseListData *HouseListData) (*ToolResult, error) {
+	// Get houses based on guest count and availability
+	houses, err := h.stores.AvailableHouses(houseListData.Guests, houseListData.CheckIn, houseListData.CheckOut)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving houses: %v", err)
 	}
 
-	if len(houses) > 0 {
-		// Sort houses: first by exact guest count match, then by price
-		// We'll do this sorting manually to avoid importing additional packages
-		for i := 0; i < len(houses)-1; i++ {
-			for j := i + 1; j < len(houses); j++ {
-				// Prioritize houses that exactly match the requested guest count
-				exactMatchI := houses[i].Guests == houseListData.Guests
-				exactMatchJ := houses[j].Guests == houseListData.Guests
-
-				shouldSwap := false
-				if exactMatchI && !exactMatchJ {
-					// i should come first, no swap needed
-					shouldSwap = false
-				} else if !exactMatchI && exactMatchJ {
-					// j should come first, swap needed
-					shouldSwap = true
-				} else {
-					// If both have the same match status, sort by price (ascending)
-					shouldSwap = houses[i].PricePerNight > houses[j].PricePerNight
-				}
-
-				if shouldSwap {
-					houses[i], houses[j] = houses[j], houses[i]
-				}
+	if len(houses) == 0 {
+		return h.fullyBookedResult(state, houseListData)
+	}
+
+	// Sort houses: first by exact guest count match, then by price
+	// We'll do this sorting manually to avoid importing additional packages
+	for i := 0; i < len(houses)-1; i++ {
+		for j := i + 1; j < len(houses); j++ {
+			// Prioritize houses that exactly match the requested guest count
+			exactMatchI := houses[i].Guests == houseListData.Guests
+			exactMatchJ := houses[j].Guests == houseListData.Guests
+
+			shouldSwap := false
+			if exactMatchI && !exactMatchJ {
+				// i should come first, no swap needed
+				shouldSwap = false
+			} else if !exactMatchI && exactMatchJ {
+				// j should come first, swap needed
+				shouldSwap = true
+			} else {
+				// If both have the same match status, sort by price (ascending)
+				shouldSwap = houses[i].PricePerNight > houses[j].PricePerNight
 			}
-		}
 
-		// Create a structured response that includes house details and image URLs
-		var houseOptionsList []HouseOption
-		for _, house := range houses {
-			houseOptionsList = append(houseOptionsList, HouseOption{
-				ID:            house.ID,
-				Name:          house.Name,
-				Guests:        house.Guests,
-				PricePerNight: house.PricePerNight,
-				ImageURL:      house.ImageURL,
-			})
+			if shouldSwap {
+				houses[i], houses[j] = houses[j], houses[i]
+			}
 		}
+	}
+
+	// Create a structured response that includes house details and image URLs
+	var houseOptionsList []HouseOption
+	for _, house := range houses {
+		houseOptionsList = append(houseOptionsList, HouseOption{
+			ID:            house.ID,
+			Name:          house.Name,
+			Guests:        house.Guests,
+			PricePerNight: house.PricePerNight,
+			ImageURL:      house.ImageURL,
+		})
+	}
+
+	result, err := jsonResult(map[string]interface{}{
+		"houses":  houseOptionsList,
+		"message": "The houses are shown to the user as selectable cards. Ask the user to select one of them.",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The frontend renders the options directly
+	result.Type = "house_options"
+	result.Data = houseOptionsList
+	return result, nil
+}
 
-		// Convert to JSON for the frontend
-		houseOptionsJSON, err := json.Marshal(houseOptionsList)
+// fullyBookedResult tells the model why no house was found and, when the houses are
+// only booked, which nearby dates are still free. The offered check-in dates are
+// recorded in the state, so picking one is not mistaken for a misread date.
+func (h *toolHandlers) fullyBookedResult(state *booking_flow.State, houseListData *HouseListData) (*ToolResult, error) {
+	if houseListData.CheckIn != "" {
+		nearest, err := h.stores.FindNearestAvailableDates(houseListData.Guests, houseListData.CheckIn, houseListData.CheckOut,
+			date_resolver.Today().Format(date_resolver.DateLayout), nearestDatesWindow, maxNearestDates)
 		if err != nil {
-			return nil, fmt.Errorf("error marshaling house options: %v", err)
+			return nil, fmt.Errorf("error searching free dates: %v", err)
 		}
 
-		// Return a structured response that the frontend can parse
-		return map[string]interface{}{
-			"type":    "house_options",
-			"houses":  string(houseOptionsJSON),
-			"message": "Please select one of these houses:",
-		}, nil
-	} else {
-		houseOptions := "I'm sorry, but we don't have any houses available for " +
-			fmt.Sprintf("%d guests at the moment. Would you like to try a different number of guests?",
-				houseListData.Guests)
-
-		return map[string]interface{}{
-			"message": houseOptions,
-		}, nil
+		if len(nearest) > 0 {
+			var dates, checkIns []string
+			for _, stay := range nearest {
+				dates = append(dates, fmt.Sprintf("%s to %s (%s)", stay.CheckIn, stay.CheckOut, strings.Join(stay.Houses, ", ")))
+				checkIns = append(checkIns, stay.CheckIn)
+			}
+			state.SuggestCheckIns(checkIns)
+			return jsonResult(map[string]interface{}{
+				"houses":                  []HouseOption{},
+				"fully_booked":            true,
+				"nearest_available_dates": nearest,
+				"message": fmt.Sprintf("Every house for %d guests is fully booked from %s to %s. The nearest free dates are %s. Offer these dates to the user; if they pick one, call update_booking_details with both the check_in and the check_out of that stay, then call get_houses again.",
+					houseListData.Guests, houseListData.CheckIn, houseListData.CheckOut, strings.Join(dates, "; ")),
+			})
+		}
 	}
+
+	return jsonResult(map[string]interface{}{
+		"houses": []HouseOption{},
+		"message": fmt.Sprintf("No houses are available for %d guests around these dates. Ask the user whether they would like to try a different number of guests or other dates.",
+			houseListData.Guests),
+	})
 }
@@ -1,74 +1,169 @@
 package function_calling
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"strconv"
 	"time"
 
+	"resort-app-server/booking_flow"
+	"resort-app-server/booking_lifecycle"
+	"resort-app-server/idempotency"
 	"resort-app-server/models"
+	"resort-app-server/phone_number"
+	"resort-app-server/pricing"
 	"resort-app-server/repository"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
-// BookingData represents the data structure for booking function calling
+// BookingData represents the arguments of the save_booking tool
 type BookingData struct {
-	ResortName   string  `json:"resort_name"`
-	CheckIn      string  `json:"check_in"`
-	CheckOut     string  `json:"check_out"`
-	Guests       int     `json:"guests"`
-	TotalPrice   float64 `json:"total_price"`
-	CustomerName string  `json:"customer_name"`
-	PhoneNumber  string  `json:"phone_number"`
+	ResortName   string `json:"resort_name"`
+	CheckIn      string `json:"check_in"`
+	CheckOut     string `json:"check_out"`
+	Guests       int    `json:"guests"`
+	CustomerName string `json:"customer_name"`
+	PhoneNumber  string `json:"phone_number"`
+}
+
+func (h *toolHandlers) saveBookingTool() Tool {
+	return Tool{
+		Name:        "save_booking",
+		Description: "Save the booking once the user has confirmed the summary and provided their full name and phone number.",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"resort_name": {
+					Type:        jsonschema.String,
+					Description: "Name of the selected house, exactly as returned by get_houses",
+				},
+				"check_in": {
+					Type:        jsonschema.String,
+					Description: "Check-in date in YYYY-MM-DD format",
+				},
+				"check_out": {
+					Type:        jsonschema.String,
+					Description: "Check-out date in YYYY-MM-DD format",
+				},
+				"guests": {
+					Type:        jsonschema.Integer,
+					Description: "Number of guests",
+				},
+				"customer_name": {
+					Type:        jsonschema.String,
+					Description: "Full name of the customer",
+				},
+				"phone_number": {
+					Type:        jsonschema.String,
+					Description: "Phone number of the customer",
+				},
+			},
+			Required: []string{"resort_name", "check_in", "check_out", "guests", "customer_name", "phone_number"},
+		},
+		Handler: h.handleSaveBooking,
+	}
 }
 
-// ExtractBookingData extracts booking data from AI response when function calling is executed
-func ExtractBookingData(messageContent string) (*BookingData, bool) {
-	// Look for booking data in the format specified in the system prompt
-	startTag := "<BOOKING_DATA>"
-	endTag := "</BOOKING_DATA>"
+// handleSaveBooking is the handler of the save_booking tool
+func (h *toolHandlers) handleSaveBooking(ctx context.Context, arguments json.RawMessage) (*ToolResult, error) {
+	var bookingData BookingData
+	if err := json.Unmarshal(arguments, &bookingData); err != nil {
+		return errorResult(fmt.Errorf("invalid arguments: %v", err)), nil
+	}
 
-	startIdx := FindStringIndex(messageContent, startTag)
-	if startIdx == -1 {
-		return nil, false
+	state := booking_flow.FromContext(ctx)
+	if state == nil {
+		return nil, fmt.Errorf("no booking state in context")
 	}
 
-	endIdx := FindStringIndex(messageContent, endTag)
-	if endIdx == -1 {
-		return nil, false
+	// The check-in date was checked against what the user wrote when it was recorded
+	if state.CheckIn != "" {
+		bookingData.CheckIn = state.CheckIn
 	}
 
-	// Extract the JSON data between the tags
-	bookingDataJSON := messageContent[startIdx+len(startTag) : endIdx]
-	// Clean up whitespace
-	bookingDataJSON = TrimString(bookingDataJSON)
+	// Validation problems are sent back to the model so it can ask the user again
+	if err := h.ValidateBookingData(&bookingData); err != nil {
+		return errorResult(fmt.Errorf("invalid booking data: %v", err)), nil
+	}
 
-	// Parse the JSON into a BookingData struct
-	var bookingData BookingData
-	if err := json.Unmarshal([]byte(bookingDataJSON), &bookingData); err != nil {
-		fmt.Printf("Error parsing booking data: %v\n", err)
-		return nil, false
+	// The booking is only saved when every earlier step of the dialogue was completed
+	if state.CurrentStep() == booking_flow.StepContact {
+		if err := state.SetContact(bookingData.CustomerName, bookingData.PhoneNumber); err != nil {
+			return h.stateErrorResult(state, err)
+		}
+	}
+	if state.CurrentStep() == booking_flow.StepVerifyPhone {
+		message, err := h.requestPhoneVerification(ctx, state)
+		if err != nil {
+			return h.stateErrorResult(state, err)
+		}
+		if state.CurrentStep() == booking_flow.StepVerifyPhone {
+			return h.stateErrorResult(state, fmt.Errorf("booking rejected: the phone number is not verified yet. %s", message))
+		}
+	}
+	if err := state.ValidateBooking(bookingData.ResortName, bookingData.CheckIn, bookingData.CheckOut, bookingData.Guests); err != nil {
+		return h.stateErrorResult(state, fmt.Errorf("booking rejected: %v", err))
+	}
+	// The booking keeps the phone number that was verified
+	if phone, err := phone_number.Normalize(bookingData.PhoneNumber); err != nil || phone != state.PhoneNumber {
+		return h.stateErrorResult(state, fmt.Errorf("booking rejected: phone number %q is not the verified number %s, call update_booking_details to change it", bookingData.PhoneNumber, state.PhoneNumber))
+	}
+	bookingData.PhoneNumber = state.PhoneNumber
+
+	booking, err := h.saveBookingOnce(ctx, &bookingData)
+	if err == errBookingInProgress {
+		return errorResult(fmt.Errorf("this booking is already being saved, do not call save_booking again")), nil
+	}
+	if err == errBookingRemoved {
+		return h.stateErrorResult(state, fmt.Errorf("this booking was saved earlier and has since been removed by the resort, ask the user to contact the receptionist"))
+	}
+	if conflict, ok := err.(*repository.BookingConflictError); ok {
+		// Another guest booked the house first, the user has to pick another one
+		state.ReleaseHouse()
+		return h.stateErrorResult(state, fmt.Errorf("%s is no longer available between %s and %s, another guest booked it a moment ago. Apologize, then call get_houses to offer the houses that are still free",
+			conflict.HouseName, conflict.CheckIn, conflict.CheckOut))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save booking: %v", err)
+	}
+	state.Complete(booking.ID)
+
+	result, err := jsonResult(map[string]interface{}{
+		"booking_id":  booking.ID,
+		"reference":   booking.Reference,
+		"status":      booking.Status,
+		"total_price": booking.TotalPrice,
+		"message":     "The booking is saved and pending confirmation from the receptionist. Give the user the reference code, they need it to look up the booking.",
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &bookingData, true
+	result.Type = "booking_created"
+	result.Data = booking
+	return result, nil
 }
 
 // ValidateBookingData ensures booking data is valid before saving
-func ValidateBookingData(booking *BookingData) error {
-	validResorts := map[string]bool{
-		"Garden Cottage":  true,
-		"Pool Villa":      true,
-		"Beach House":     true,
-		"Mountain Cabin":  true,
-		"Log Cabin":       true,
-		"Luxury Lodge":    true,
-		"City Apartment":  true,
-		"Penthouse Suite": true,
-		"Executive Loft":  true,
-	}
-
-	// Validasi resort name
-	if !validResorts[booking.ResortName] {
+func (h *toolHandlers) ValidateBookingData(booking *BookingData) error {
+	// Validasi resort name against the house catalog
+	house, err := h.stores.Houses.GetHouseByName(booking.ResortName)
+	if err != nil {
+		return fmt.Errorf("error retrieving houses: %v", err)
+	}
+	if house == nil {
 		return fmt.Errorf("invalid resort name: %s", booking.ResortName)
 	}
+	booking.ResortName = house.Name
+
+	if booking.Guests > house.Guests {
+		return fmt.Errorf("%s accommodates at most %d guests", house.Name, house.Guests)
+	}
 
 	// Validasi required fields
 	if booking.CustomerName == "" {
@@ -87,33 +182,125 @@ func ValidateBookingData(booking *BookingData) error {
 		return fmt.Errorf("number of guests must be greater than 0")
 	}
 
+	if booking.CheckOut == "" {
+		return fmt.Errorf("check-out date is required")
+	}
+
 	// Validasi format tanggal
-	_, err := time.Parse("2006-01-02", booking.CheckIn)
+	checkIn, err := time.Parse("2006-01-02", booking.CheckIn)
 	if err != nil {
 		return fmt.Errorf("invalid check-in date format: %s", booking.CheckIn)
 	}
 
+	checkOut, err := time.Parse("2006-01-02", booking.CheckOut)
+	if err != nil {
+		return fmt.Errorf("invalid check-out date format: %s", booking.CheckOut)
+	}
+
+	if !checkOut.After(checkIn) {
+		return fmt.Errorf("check-out date %s must be after the check-in date %s", booking.CheckOut, booking.CheckIn)
+	}
+
 	return nil
 }
 
-// SaveBookingToDatabase saves the booking data to the database
-func SaveBookingToDatabase(bookingData *BookingData) error {
+// chatBookingKeyTTL is how long the booking saved by a conversation is remembered, a
+// conversation is not resumed after that
+const chatBookingKeyTTL = 30 * 24 * time.Hour
+
+var (
+	errBookingInProgress = errors.New("booking is already being saved")
+	errBookingRemoved    = errors.New("booking was saved and later deleted")
+)
+
+type conversationIDKey struct{}
+
+// WithConversationID attaches the ID of the conversation the tools run for to a context
+func WithConversationID(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, conversationIDKey{}, conversationID)
+}
+
+// conversationIDFromContext returns the conversation ID attached to a context, or ""
+func conversationIDFromContext(ctx context.Context) string {
+	conversationID, _ := ctx.Value(conversationIDKey{}).(string)
+	return conversationID
+}
+
+// saveBookingOnce saves the booking of a conversation exactly once. It is keyed by the
+// conversation and a hash of the booking data, so a repeated save_booking call or a
+// retried chat request returns the booking that was already saved.
+func (h *toolHandlers) saveBookingOnce(ctx context.Context, bookingData *BookingData) (*models.Booking, error) {
+	conversationID := conversationIDFromContext(ctx)
+	if conversationID == "" {
+		return h.SaveBookingToDatabase(bookingData)
+	}
+
+	payload, err := json.Marshal(bookingData)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := idempotency.Hash(payload)
+	key := "chat " + conversationID + " " + payloadHash
+
+	record, err := h.stores.Idempotency.ReserveIdempotencyKey(key, payloadHash, time.Now().Add(chatBookingKeyTTL))
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		if record.StatusCode == 0 {
+			return nil, errBookingInProgress
+		}
+		bookingID, _ := strconv.Atoi(record.Response)
+		booking, err := h.stores.Bookings.GetBookingByID(bookingID)
+		if err == nil && booking == nil {
+			err = errBookingRemoved
+		}
+		return booking, err
+	}
+
+	booking, err := h.SaveBookingToDatabase(bookingData)
+	if err != nil {
+		if releaseErr := h.stores.Idempotency.ReleaseIdempotencyKey(key); releaseErr != nil {
+			log.Printf("Failed to release the booking key of conversation %s: %v", conversationID, releaseErr)
+		}
+		return nil, err
+	}
+
+	// The booking is saved either way, the conversation state still records it
+	if err := h.stores.Idempotency.CompleteIdempotencyKey(key, http.StatusCreated, nil, strconv.Itoa(booking.ID)); err != nil {
+		log.Printf("Failed to record the booking key of conversation %s: %v", conversationID, err)
+	}
+	return booking, nil
+}
+
+// SaveBookingToDatabase saves the booking data to the database, priced from the house rate
+func (h *toolHandlers) SaveBookingToDatabase(bookingData *BookingData) (*models.Booking, error) {
+	quote, err := pricing.QuoteByHouseName(h.stores.Houses, bookingData.ResortName, bookingData.CheckIn, bookingData.CheckOut)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert BookingData to models.Booking
 	booking := &models.Booking{
 		// ID (booking ID) is auto-generated by the database
 		UserID:       0, // Anonymous user ID for public bookings
-		ResortName:   bookingData.ResortName,
+		HouseID:      quote.HouseID,
+		ResortName:   quote.HouseName,
 		CheckIn:      bookingData.CheckIn,
-		CheckOut:     bookingData.CheckOut,
+		CheckOut:     quote.CheckOut,
 		Guests:       bookingData.Guests,
-		TotalPrice:   bookingData.TotalPrice,
-		Status:       "pending", // Default status
-		PaymentDate:  "",        // Will be set when payment is processed
+		TotalPrice:   quote.TotalPrice,
+		Status:       booking_lifecycle.StatusPending,
+		PaymentDate:  "", // Will be set when payment is processed
 		CustomerName: bookingData.CustomerName,
 		PhoneNumber:  bookingData.PhoneNumber,
 		// CreatedAt is set automatically by the database
 	}
 
 	// Save to database
-	return repository.CreateBooking(booking)
-}
\ No newline at end of file
+	if err := h.stores.Bookings.CreateBooking(booking); err != nil {
+		return nil, err
+	}
+
+	return booking, nil
+}
@@ -1,27 +0,0 @@
-package function_calling
-
-// FindStringIndex finds the index of a substring in a string
-func FindStringIndex(s, substr string) int {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return i
-		}
-	}
-	return -1
-}
-
-// TrimString removes leading and trailing whitespace from a string
-func TrimString(s string) string {
-	// Remove leading and trailing whitespace
-	start := 0
-	for start < len(s) && (s[start] == ' ' || s[start] == '\t' || s[start] == '\n') {
-		start++
-	}
-	
-	end := len(s)
-	for end > start && (s[end-1] == ' ' || s[end-1] == '\t' || s[end-1] == '\n') {
-		end--
-	}
-	
-	return s[start:end]
-}
\ No newline at end of file
@@ -0,0 +1,148 @@
+package function_calling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"resort-app-server/booking_flow"
+	"resort-app-server/phone_verification"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// VerifyPhoneData represents the arguments of the verify_phone tool
+type VerifyPhoneData struct {
+	Code   string `json:"code"`
+	Resend bool   `json:"resend"`
+}
+
+func (h *toolHandlers) verifyPhoneTool() Tool {
+	return Tool{
+		Name:        "verify_phone",
+		Description: "Check the verification code the user received on their phone, or send a new code. The booking can only be saved once the phone number is verified.",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"code": {
+					Type:        jsonschema.String,
+					Description: "The code the user received, exactly as they typed it",
+				},
+				"resend": {
+					Type:        jsonschema.Boolean,
+					Description: "True to send a new code instead, when the user did not receive the code or it expired",
+				},
+			},
+		},
+		Handler: h.handleVerifyPhone,
+	}
+}
+
+// handleVerifyPhone is the handler of the verify_phone tool
+func (h *toolHandlers) handleVerifyPhone(ctx context.Context, arguments json.RawMessage) (*ToolResult, error) {
+	state := booking_flow.FromContext(ctx)
+	if state == nil {
+		return nil, fmt.Errorf("no booking state in context")
+	}
+
+	var data VerifyPhoneData
+	if err := json.Unmarshal(arguments, &data); err != nil {
+		return errorResult(fmt.Errorf("invalid arguments: %v", err)), nil
+	}
+
+	if step := state.CurrentStep(); step != booking_flow.StepVerifyPhone {
+		return h.stateErrorResult(state, fmt.Errorf("no phone number is waiting for verification, the current step is %q", step))
+	}
+
+	if data.Resend {
+		return h.phoneVerificationResult(ctx, state)
+	}
+	if data.Code == "" {
+		return h.stateErrorResult(state, fmt.Errorf("the code is required, ask the user for the code sent to %s", state.PhoneNumber))
+	}
+
+	scope, err := chatVerificationScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.verifier.Check(scope, state.PhoneNumber, data.Code)
+	var wrongCode *phone_verification.WrongCodeError
+	switch {
+	case errors.As(err, &wrongCode) && wrongCode.AttemptsLeft > 0:
+		return h.stateErrorResult(state, fmt.Errorf("the code is wrong, %d attempts left. Ask the user to check the code", wrongCode.AttemptsLeft))
+	case errors.As(err, &wrongCode), err == phone_verification.ErrTooManyAttempts:
+		return h.stateErrorResult(state, fmt.Errorf("the code is wrong and no attempts are left. Offer to send a new code with resend set to true"))
+	case err == phone_verification.ErrCodeExpired, err == phone_verification.ErrNoCode:
+		return h.stateErrorResult(state, fmt.Errorf("%v. Offer to send a new code with resend set to true", err))
+	case err != nil:
+		return nil, fmt.Errorf("failed to check the verification code: %v", err)
+	}
+
+	if err := state.VerifyPhone(); err != nil {
+		return h.stateErrorResult(state, err)
+	}
+
+	summary, err := h.bookingSummary(state)
+	if err != nil {
+		return nil, err
+	}
+	summary["message"] = "The phone number is verified, save the booking now."
+	return jsonResult(summary)
+}
+
+// chatVerificationScope returns the scope of the codes sent in a conversation
+func chatVerificationScope(ctx context.Context) (string, error) {
+	conversationID := conversationIDFromContext(ctx)
+	if conversationID == "" {
+		return "", fmt.Errorf("no conversation ID in context")
+	}
+	return "chat " + conversationID, nil
+}
+
+// requestPhoneVerification sends a code to the phone number of the booking once it waits
+// for verification, and returns what the model should tell the user. Without phone
+// verification the number is accepted as it is. Errors are meant for the model.
+func (h *toolHandlers) requestPhoneVerification(ctx context.Context, state *booking_flow.State) (string, error) {
+	if state.CurrentStep() != booking_flow.StepVerifyPhone {
+		return "", nil
+	}
+	if h.verifier == nil {
+		return "", state.VerifyPhone()
+	}
+
+	scope, err := chatVerificationScope(ctx)
+	if err == nil {
+		err = h.verifier.Send(ctx, scope, state.PhoneNumber)
+	}
+	var tooSoon *phone_verification.TooSoonError
+	if errors.As(err, &tooSoon) {
+		return fmt.Sprintf("A verification code was already sent to %s, a new one can be sent in %d seconds. Ask the user for the code and call verify_phone with it.",
+			state.PhoneNumber, int(tooSoon.RetryAfter.Seconds())+1), nil
+	}
+	if err != nil {
+		log.Printf("Failed to send a verification code to %s: %v", state.PhoneNumber, err)
+		return "", fmt.Errorf("the verification code could not be sent to %s, ask the user to check the phone number", state.PhoneNumber)
+	}
+	return fmt.Sprintf("A verification code was sent to %s. Ask the user for the code and call verify_phone with it.", state.PhoneNumber), nil
+}
+
+// phoneVerificationResult sends a code when the booking waits for phone verification and
+// reports the state together with the instruction for the model
+func (h *toolHandlers) phoneVerificationResult(ctx context.Context, state *booking_flow.State) (*ToolResult, error) {
+	message, err := h.requestPhoneVerification(ctx, state)
+	if err != nil {
+		return h.stateErrorResult(state, err)
+	}
+
+	summary, err := h.bookingSummary(state)
+	if err != nil {
+		return nil, err
+	}
+	if message != "" {
+		summary["message"] = message
+	}
+	return jsonResult(summary)
+}